@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// saveArchive bundles a run into the --archive tar.gz: the report, the raw
+// output of every check that ran (and its error output on its own), the
+// effective check definitions and the host facts, for attaching to incident
+// tickets.
+func saveArchive(checks []Check, report *Report) {
+	if archivePath == "" {
+		return
+	}
+	data, err := buildArchive(checks, report, detectFacts())
+	if err == nil {
+		err = writeFileAtomic(archivePath, data, 0o640)
+	}
+	if err != nil {
+		log.Errorf("Error writing archive: %v", err)
+	}
+}
+
+func buildArchive(checks []Check, report *Report, facts *systemFacts) ([]byte, error) {
+	var files []archiveFile
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, archiveFile{"report.json", reportJSON})
+
+	var config bytes.Buffer
+	enc := yaml.NewEncoder(&config)
+	enc.SetIndent(2)
+	if err := enc.Encode(struct {
+		Checks []Check `yaml:"checks"`
+	}{checks}); err != nil {
+		return nil, err
+	}
+	files = append(files, archiveFile{"config.yaml", config.Bytes()})
+
+	factsJSON, err := json.MarshalIndent(map[string]any{
+		"hostname":   report.Hostname,
+		"os":         facts.OS,
+		"os_like":    facts.OSLike,
+		"os_version": facts.OSVersion,
+		"arch":       facts.Arch,
+		"platform":   facts.Platform,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, archiveFile{"facts.json", factsJSON})
+
+	for i, r := range report.Results {
+		if r.Status == statusSkipped {
+			continue
+		}
+		name := fmt.Sprintf("outputs/%02d-%s", i+1, slugify(r.Name))
+		files = append(files, archiveFile{name + ".txt", []byte(r.output)})
+		if r.stderr != "" {
+			files = append(files, archiveFile{name + ".stderr.txt", []byte(r.stderr)})
+		}
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	// Named after the run so archives unpack into their own directory
+	dir := "kumo-" + report.StartedAt.UTC().Format("20060102T150405Z") + "/"
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    dir + f.name,
+			Mode:    0o644,
+			Size:    int64(len(f.data)),
+			ModTime: report.StartedAt.Add(time.Duration(report.Duration * float64(time.Second))),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type archiveFile struct {
+	name string
+	data []byte
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Assertions decide whether a check passed from its command's output and
+// exit code. Every assertion that is set must hold. Without an explicit
+// exit_code, a check passes only when its command exits with 0.
+type Assertions struct {
+	// Output the assertions look at: stdout (the default), stderr or
+	// combined
+	Stream     string             `yaml:"stream,omitempty" toml:"stream"`
+	ExitCode   *int               `yaml:"exit_code,omitempty" toml:"exit_code"`
+	Matches    string             `yaml:"matches,omitempty" toml:"matches"`
+	NotMatches string             `yaml:"not_matches,omitempty" toml:"not_matches"`
+	Threshold  *Threshold         `yaml:"threshold,omitempty" toml:"threshold"`
+	JSONPath   *JSONPathAssertion `yaml:"jsonpath,omitempty" toml:"jsonpath"`
+}
+
+// Threshold extracts a number from the output and compares it with Value,
+// e.g. disk usage "< 90". Pattern is a regex whose first capture group (or
+// whole match, if it has none) is the number; by default the first number in
+// the output is used.
+type Threshold struct {
+	Pattern string  `yaml:"pattern,omitempty" toml:"pattern"`
+	Op      string  `yaml:"op,omitempty" toml:"op"`
+	Value   float64 `yaml:"value,omitempty" toml:"value"`
+}
+
+// JSONPathAssertion parses the output as JSON and checks the value at Path,
+// a simple "$.key.list[0].field" expression. With Op the value is compared
+// numerically with Value, otherwise with Equals its string form must match;
+// with neither the path only has to exist.
+type JSONPathAssertion struct {
+	Path   string  `yaml:"path,omitempty" toml:"path"`
+	Equals *string `yaml:"equals,omitempty" toml:"equals"`
+	Op     string  `yaml:"op,omitempty" toml:"op"`
+	Value  float64 `yaml:"value,omitempty" toml:"value"`
+}
+
+var defaultNumberPattern = regexp.MustCompile(`[-+]?\d+(?:\.\d+)?`)
+
+var comparisons = map[string]func(a, b float64) bool{
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// Streams an assertion can look at
+var assertStreams = []string{"stdout", "stderr", "combined"}
+
+// stream returns the output of res the assertions look at.
+func (a *Assertions) stream(res commandResult) string {
+	if a == nil {
+		return res.stdout
+	}
+	switch a.Stream {
+	case "stderr":
+		return res.stderr
+	case "combined":
+		return res.output
+	}
+	return res.stdout
+}
+
+// evaluate returns why the assertions don't hold for a command's output and
+// exit code, or "" if they all do.
+func (a *Assertions) evaluate(output string, exitCode int) string {
+	want := 0
+	if a != nil && a.ExitCode != nil {
+		want = *a.ExitCode
+	}
+	if exitCode != want {
+		return fmt.Sprintf("expected exit code %d, got %d", want, exitCode)
+	}
+	if a == nil {
+		return ""
+	}
+
+	if a.Matches != "" {
+		if re, err := regexp.Compile(a.Matches); err != nil || !re.MatchString(output) {
+			return fmt.Sprintf("output does not match /%s/", a.Matches)
+		}
+	}
+	if a.NotMatches != "" {
+		if re, err := regexp.Compile(a.NotMatches); err != nil || re.MatchString(output) {
+			return fmt.Sprintf("output matches /%s/", a.NotMatches)
+		}
+	}
+	if a.Threshold != nil {
+		if reason := a.Threshold.evaluate(output); reason != "" {
+			return reason
+		}
+	}
+	if a.JSONPath != nil {
+		if reason := a.JSONPath.evaluate(output); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func (t *Threshold) evaluate(output string) string {
+	re := defaultNumberPattern
+	if t.Pattern != "" {
+		var err error
+		if re, err = regexp.Compile(t.Pattern); err != nil {
+			return fmt.Sprintf("invalid threshold pattern: %v", err)
+		}
+	}
+
+	m := re.FindStringSubmatch(output)
+	if m == nil {
+		return "no number found in output for threshold"
+	}
+	raw := m[0]
+	if len(m) > 1 {
+		raw = m[1]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		return fmt.Sprintf("threshold value %q is not a number", raw)
+	}
+	return compare(n, t.Op, t.Value, "value")
+}
+
+func (j *JSONPathAssertion) evaluate(output string) string {
+	var doc any
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		return fmt.Sprintf("output is not valid JSON: %v", err)
+	}
+	v, err := lookupJSONPath(doc, j.Path)
+	if err != nil {
+		return err.Error()
+	}
+
+	switch {
+	case j.Op != "":
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Sprintf("%s is %v, not a number", j.Path, v)
+		}
+		return compare(n, j.Op, j.Value, j.Path)
+	case j.Equals != nil:
+		if got := fmt.Sprint(v); got != *j.Equals {
+			return fmt.Sprintf("%s is %q, expected %q", j.Path, got, *j.Equals)
+		}
+	}
+	return ""
+}
+
+func compare(n float64, op string, want float64, what string) string {
+	cmp, ok := comparisons[op]
+	if !ok {
+		return fmt.Sprintf("unknown comparison %q", op)
+	}
+	if !cmp(n, want) {
+		return fmt.Sprintf("%s %s is not %s %s", what, formatNumber(n), op, formatNumber(want))
+	}
+	return ""
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// lookupJSONPath resolves a "$.a.b[0]" style path in a decoded JSON doc.
+func lookupJSONPath(doc any, path string) (any, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	v := doc
+	for _, step := range steps {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[step]
+			if !ok {
+				return nil, fmt.Errorf("%s: key %q not found", path, step)
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("%s: index %s out of range", path, step)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("%s: cannot descend into %v", path, v)
+		}
+	}
+	return v, nil
+}
+
+// parseJSONPath splits "$.a.b[0]" into the steps "a", "b", "0".
+func parseJSONPath(path string) ([]string, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("jsonpath %q must start with $", path)
+	}
+
+	var steps []string
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("jsonpath %q has an empty key", path)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q has an unclosed [", path)
+			}
+			steps = append(steps, strings.Trim(rest[1:end], `'"`))
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// validate reports configuration errors in the assertions.
+func (a *Assertions) validate() []string {
+	if a == nil {
+		return nil
+	}
+
+	var problems []string
+	if a.Stream != "" && !slices.Contains(assertStreams, a.Stream) {
+		problems = append(problems, fmt.Sprintf("stream must be stdout, stderr or combined, got %q", a.Stream))
+	}
+	for _, pattern := range []string{a.Matches, a.NotMatches} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid regex %q: %v", pattern, err))
+		}
+	}
+	if t := a.Threshold; t != nil {
+		if _, err := regexp.Compile(t.Pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid threshold pattern %q: %v", t.Pattern, err))
+		}
+		if _, ok := comparisons[t.Op]; !ok {
+			problems = append(problems, fmt.Sprintf("threshold needs op <, <=, >, >=, == or !=, got %q", t.Op))
+		}
+	}
+	if j := a.JSONPath; j != nil {
+		if _, err := parseJSONPath(j.Path); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, ok := comparisons[j.Op]; j.Op != "" && !ok {
+			problems = append(problems, fmt.Sprintf("jsonpath op must be <, <=, >, >=, == or !=, got %q", j.Op))
+		}
+	}
+	return problems
+}
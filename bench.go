@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+)
+
+// benchStats are the durations of one check over the runs of "kumo bench".
+type benchStats struct {
+	name          string
+	min, max, sum float64
+	// Runs that did not pass
+	failures int
+}
+
+// runBench implements "kumo bench": it runs the check set several times,
+// bypassing the result cache, and prints the min, average and max duration
+// of every check, slowest first.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.Int("runs", 5, "how many times to run the checks")
+	registerRunFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: kumo bench [--runs N] [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *runs < 1 {
+		fs.Usage()
+		return 2
+	}
+	checks, _, err := prepareChecks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	noCache = true
+
+	stats := make([]benchStats, len(checks))
+	for run := 1; run <= *runs; run++ {
+		log.Infof("Run %d of %d", run, *runs)
+		ctx, cancel := runContext()
+		results := runChecks(ctx, checks, log.WithField("run_id", newRunID()), progress{})
+		interrupted := errors.As(context.Cause(ctx), &interruptError{})
+		cancel(nil)
+		if interrupted {
+			log.Warnf("Interrupted during run %d", run)
+			return exitInterrupted
+		}
+		for i, r := range results {
+			s := &stats[i]
+			if run == 1 || r.Duration < s.min {
+				s.min = r.Duration
+			}
+			s.name, s.max, s.sum = r.Name, max(s.max, r.Duration), s.sum+r.Duration
+			if r.Status != statusPassed {
+				s.failures++
+			}
+		}
+	}
+
+	slices.SortStableFunc(stats, func(a, b benchStats) int {
+		switch {
+		case a.sum > b.sum:
+			return -1
+		case a.sum < b.sum:
+			return 1
+		}
+		return 0
+	})
+	writeBench(os.Stdout, stats, *runs)
+	return exitOK
+}
+
+// writeBench prints the benchmark as a table, with the runs that did not
+// pass counted so that a check failing fast is not mistaken for a fast one.
+func writeBench(w io.Writer, stats []benchStats, runs int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Check\tMin\tAvg\tMax\tNot passed")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%.3fs\t%.3fs\t%.3fs\t%d/%d\n", s.name, s.min, s.sum/float64(runs), s.max, s.failures, runs)
+	}
+	tw.Flush()
+}
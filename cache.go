@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cachedResult is a check result stored under --cache-dir for checks with a
+// cache_ttl, along with the output the TUI shows.
+type cachedResult struct {
+	StoredAt time.Time   `json:"stored_at"`
+	Result   CheckResult `json:"result"`
+	Output   string      `json:"output"`
+	Stdout   string      `json:"stdout"`
+	Stderr   string      `json:"stderr"`
+}
+
+// resultCachePath returns where the result of check is cached, keyed by its
+// whole definition after the config's vars were applied, so that editing
+// its command, args, assertions, environment or anything else invalidates
+// the entry.
+func resultCachePath(check Check) string {
+	// Maps marshal with sorted keys, so the key is stable
+	definition, _ := json.Marshal(check)
+	sum := sha256.Sum256(definition)
+	return filepath.Join(cacheDir, "results", hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadCachedResult returns the cached result of check if it has a cache_ttl
+// that has not expired yet and --no-cache is not set.
+func loadCachedResult(check Check) (CheckResult, bool) {
+	if check.CacheTTL <= 0 || noCache {
+		return CheckResult{}, false
+	}
+	data, err := os.ReadFile(resultCachePath(check))
+	if err != nil {
+		return CheckResult{}, false
+	}
+	var entry cachedResult
+	if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.StoredAt) > check.CacheTTL {
+		return CheckResult{}, false
+	}
+
+	result := entry.Result
+	result.CachedAt = &entry.StoredAt
+	result.output, result.stdout, result.stderr = entry.Output, entry.Stdout, entry.Stderr
+	return result, true
+}
+
+// storeCachedResult caches the result of check if it has a cache_ttl. Only
+// passed and failed results are kept; timeouts are usually transient.
+func storeCachedResult(check Check, result CheckResult) {
+	if check.CacheTTL <= 0 || (result.Status != statusPassed && result.Status != statusFailed) {
+		return
+	}
+	data, err := json.Marshal(cachedResult{
+		StoredAt: time.Now().UTC(),
+		Result:   result,
+		Output:   result.output,
+		Stdout:   result.stdout,
+		Stderr:   result.stderr,
+	})
+	if err == nil {
+		path := resultCachePath(check)
+		if err = os.MkdirAll(filepath.Dir(path), 0o700); err == nil {
+			err = writeFileAtomic(path, data, 0o600)
+		}
+	}
+	if err != nil {
+		log.Warnf("Error caching result of %s: %v", check.Name, err)
+	}
+}
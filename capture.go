@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// cappedBuffer keeps the first limit bytes written to it and counts the
+// rest, so a runaway command cannot exhaust memory.
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	keep := min(len(p), max(b.limit-b.buf.Len(), 0))
+	b.buf.Write(p[:keep])
+	b.dropped += int64(len(p) - keep)
+	return len(p), nil
+}
+
+// String returns the kept output, followed by a marker saying how much was
+// cut off and where the full output went, if anywhere.
+func (b *cappedBuffer) String(spillPath string) string {
+	if b.dropped == 0 {
+		return b.buf.String()
+	}
+	// The limit may have split a multi-byte character
+	s := strings.ToValidUTF8(b.buf.String(), "")
+	marker := fmt.Sprintf("[output truncated: %d more bytes]", b.dropped)
+	if spillPath != "" {
+		marker = fmt.Sprintf("[output truncated: %d more bytes, full output in %s]", b.dropped, spillPath)
+	}
+	return strings.TrimRight(s, "\n") + "\n" + marker
+}
+
+// lockedWriter serializes the writes of both output streams, which exec
+// copies from separate goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// redactingWriter writes to w with the secret values replaced. A secret may
+// be split across writes, so the bytes that could begin one are held back
+// until the next write or flush.
+type redactingWriter struct {
+	w       io.Writer
+	pending string
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	r.pending = redactSecrets(r.pending + string(p))
+	if n := len(r.pending) - max(longestSecret()-1, 0); n > 0 {
+		if _, err := io.WriteString(r.w, r.pending[:n]); err != nil {
+			return 0, err
+		}
+		r.pending = r.pending[n:]
+	}
+	return len(p), nil
+}
+
+// flush writes the held back bytes.
+func (r *redactingWriter) flush() error {
+	_, err := io.WriteString(r.w, r.pending)
+	r.pending = ""
+	return err
+}
+
+// outputCapture collects a command's output: each stream and both
+// interleaved, bounded by --max-output-bytes. With --spill-output the
+// interleaved output is also written in full, with the secrets redacted,
+// to a temporary file, which is kept only when the output was truncated.
+type outputCapture struct {
+	stdout, stderr, combined cappedBuffer
+	spill                    *os.File
+	spillWriter              *redactingWriter
+}
+
+func newOutputCapture(name string) *outputCapture {
+	c := &outputCapture{
+		stdout:   cappedBuffer{limit: maxOutputSize},
+		stderr:   cappedBuffer{limit: maxOutputSize},
+		combined: cappedBuffer{limit: maxOutputSize},
+	}
+	if spillOutput {
+		f, err := os.CreateTemp("", "kumo-"+slugify(name)+"-*.log")
+		if err != nil {
+			log.Warnf("Error creating output file for %s: %v", name, err)
+		} else {
+			c.spill, c.spillWriter = f, &redactingWriter{w: f}
+		}
+	}
+	return c
+}
+
+// writers returns the writers for the command's stdout and stderr.
+func (c *outputCapture) writers() (io.Writer, io.Writer) {
+	var combined io.Writer = &c.combined
+	if c.spill != nil {
+		combined = io.MultiWriter(&c.combined, c.spillWriter)
+	}
+	combined = &lockedWriter{w: combined}
+	return io.MultiWriter(&c.stdout, combined), io.MultiWriter(&c.stderr, combined)
+}
+
+// finish closes the spill file, removing it unless the output was truncated,
+// and returns its path if it was kept.
+func (c *outputCapture) finish() string {
+	if c.spill == nil {
+		return ""
+	}
+	err := c.spillWriter.flush()
+	if closeErr := c.spill.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Warnf("Error writing output file %s: %v", c.spill.Name(), err)
+	}
+	if c.combined.dropped == 0 {
+		os.Remove(c.spill.Name())
+		return ""
+	}
+	return c.spill.Name()
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Check describes a single system check: the shell command or native
+// runner to run and the hint shown to the user when it fails.
+type Check struct {
+	Name string `yaml:"name" toml:"name"`
+	Cmd  string `yaml:"cmd,omitempty" toml:"cmd"`
+	// Native runner used instead of Cmd, configured by Args
+	Native     string            `yaml:"native,omitempty" toml:"native"`
+	Args       map[string]string `yaml:"args,omitempty" toml:"args"`
+	ErrHint    string            `yaml:"err_hint,omitempty" toml:"err_hint"`
+	Timeout    time.Duration     `yaml:"timeout,omitempty" toml:"timeout"`
+	Profiles   []string          `yaml:"profiles,omitempty" toml:"profiles"`
+	Tags       []string          `yaml:"tags,omitempty" toml:"tags"`
+	DependsOn  []string          `yaml:"depends_on,omitempty" toml:"depends_on"`
+	Severity   string            `yaml:"severity,omitempty" toml:"severity"`
+	Priority   string            `yaml:"priority,omitempty" toml:"priority"`
+	Assert     *Assertions       `yaml:"assert,omitempty" toml:"assert"`
+	Retries    int               `yaml:"retries,omitempty" toml:"retries"`
+	RetryDelay time.Duration     `yaml:"retry_delay,omitempty" toml:"retry_delay"`
+	When       string            `yaml:"when,omitempty" toml:"when"`
+	// How to fix a failure, included in reports for failed checks
+	Remediation string `yaml:"remediation,omitempty" toml:"remediation"`
+	// IDs of the compliance controls the check implements, e.g. "CIS 1.1.2"
+	Controls []string `yaml:"controls,omitempty" toml:"controls"`
+	// Names of config secrets exported to the command's environment
+	Secrets []string `yaml:"secrets,omitempty" toml:"secrets"`
+	// Variables set for the command, on top of kumo's environment unless
+	// InheritEnv is false
+	Env        map[string]string `yaml:"env,omitempty" toml:"env"`
+	InheritEnv *bool             `yaml:"inherit_env,omitempty" toml:"inherit_env"`
+	// How long a result stays cached and is reused instead of running the
+	// check again; zero disables caching
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty" toml:"cache_ttl"`
+	// bash (the default), sh or none to run cmd directly without a shell
+	Shell string `yaml:"shell,omitempty" toml:"shell"`
+	// Working directory of the command, and the user it runs as instead of
+	// kumo's own (or the invoking user's)
+	Dir  string `yaml:"dir,omitempty" toml:"dir"`
+	User string `yaml:"user,omitempty" toml:"user"`
+	// Set for checks that need root; the others run as the invoking user
+	// when kumo was started with sudo
+	Privileged bool `yaml:"privileged,omitempty" toml:"privileged"`
+	// Runs cmd in the systemd-run sandbox, or with false never does even
+	// under --sandbox, for checks that need full access to the host
+	Sandbox *bool `yaml:"sandbox,omitempty" toml:"sandbox"`
+	// CPU time, memory and priority limits of the command
+	Limits *ResourceLimits `yaml:"limits,omitempty" toml:"limits"`
+
+	// Resolved from Secrets when the config is loaded
+	secretSpecs map[string]SecretSpec
+}
+
+// Check result statuses
+const (
+	statusPassed   = "Passed"
+	statusFailed   = "Failed"
+	statusSkipped  = "Skipped"
+	statusTimedOut = "TimedOut"
+	// Stopped by --fail-fast or a signal before it finished
+	statusCancelled = "Cancelled"
+)
+
+// Check severities, from least to most severe
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+var severityRanks = map[string]int{severityInfo: 0, severityWarning: 1, severityCritical: 2}
+
+// severity returns the check's severity, defaulting to warning.
+func (c Check) severity() string {
+	if c.Severity == "" {
+		return severityWarning
+	}
+	return c.Severity
+}
+
+// Check priorities, in the order their commands are given a slot: high
+// for quick checks worth seeing first, low for slow ones
+const (
+	priorityHigh   = "high"
+	priorityNormal = "normal"
+	priorityLow    = "low"
+)
+
+var priorityRanks = map[string]int{priorityHigh: 0, priorityNormal: 1, priorityLow: 2}
+
+// priorityRank orders the check among those waiting to run, defaulting to
+// normal priority. With --sequential every check ranks the same, so they
+// run in config order.
+func (c Check) priorityRank() int {
+	if c.Priority == "" || sequential {
+		return priorityRanks[priorityNormal]
+	}
+	return priorityRanks[c.Priority]
+}
+
+// How long to wait for a killed command's children to release its output
+// pipes before giving up on them.
+const commandWaitDelay = 2 * time.Second
+
+// executeCheck runs a single check, retrying a failed or timed out command
+// up to check.Retries times, and builds its result. Once ctx is done the
+// command is killed and no more attempts are made.
+func executeCheck(ctx context.Context, check Check) CheckResult {
+	start := time.Now()
+	status, msg, res := attemptCheck(ctx, check)
+	attempts := 1
+	for ; status != statusPassed && attempts <= check.Retries && ctx.Err() == nil; attempts++ {
+		select {
+		case <-time.After(check.RetryDelay):
+		case <-ctx.Done():
+		}
+		status, msg, res = attemptCheck(ctx, check)
+	}
+	if attempts > 1 {
+		msg += fmt.Sprintf(" after %d attempts", attempts)
+	}
+	elapsed := time.Since(start)
+
+	result := CheckResult{
+		Name:       check.Name,
+		Status:     status,
+		Severity:   check.severity(),
+		Message:    redactSecrets(msg),
+		Controls:   check.Controls,
+		Duration:   elapsed.Round(time.Millisecond).Seconds(),
+		Data:       res.data,
+		OutputFile: res.outputFile,
+		output:     redactSecrets(res.raw),
+		stdout:     redactSecrets(res.stdout),
+		stderr:     redactSecrets(res.stderr),
+	}
+	if res.exitCode >= 0 {
+		result.ExitCode = &res.exitCode
+	}
+	if status == statusFailed || status == statusTimedOut {
+		result.Remediation = check.Remediation
+	}
+	return result
+}
+
+// attemptCheck runs the check's command once and returns its status,
+// message and the command's outcome.
+func attemptCheck(ctx context.Context, check Check) (string, string, commandResult) {
+	env, err := secretEnv(check)
+	if err != nil {
+		return statusFailed, check.ErrHint + " (" + err.Error() + ")", commandResult{exitCode: -1, err: err}
+	}
+	cmdCtx := ctx
+	if check.Timeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, check.Timeout)
+		defer cancel()
+	}
+	res := check.runner().Run(cmdCtx, check, env)
+	if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
+		res.timedOut, res.exitCode = true, -1
+	}
+
+	status, msg := statusPassed, res.stdout
+	if msg == "" {
+		msg = res.stderr
+	}
+	switch {
+	case ctx.Err() != nil:
+		// The whole run ended, by its deadline, a signal or --fail-fast,
+		// whatever the runner made of its cancelled context
+		res.exitCode = -1
+		status, msg = runEndedStatus(ctx), context.Cause(ctx).Error()
+	case res.timedOut:
+		status, msg = statusTimedOut, fmt.Sprintf("Timed out after %s", check.Timeout)
+	case res.err != nil:
+		status, msg = statusFailed, check.ErrHint+" ("+res.err.Error()+")"
+	default:
+		if reason := check.Assert.evaluate(check.Assert.stream(res), res.exitCode); reason != "" {
+			status = statusFailed
+			if check.Assert == nil {
+				// A plain non-zero exit: the error output says more than the
+				// code
+				reason = res.stderr
+				if reason == "" {
+					reason = res.stdout
+				}
+			}
+			msg = check.ErrHint + " (" + reason + ")"
+		}
+	}
+	return status, msg, res
+}
+
+// runEndedStatus is the status of a check cut short because the run's ctx
+// is done: Cancelled by a signal, by quitting or by --fail-fast, and
+// TimedOut by the run's deadline.
+func runEndedStatus(ctx context.Context) string {
+	if errors.As(context.Cause(ctx), &failFastError{}) || interrupted(ctx) {
+		return statusCancelled
+	}
+	return statusTimedOut
+}
+
+// commandResult is the outcome of running a check command.
+type commandResult struct {
+	// Trimmed output of each stream, and of both interleaved as written
+	stdout, stderr, output string
+	// The interleaved output with its leading whitespace, which column
+	// layouts need
+	raw string
+	// -1 when the command was killed or could not be run
+	exitCode int
+	timedOut bool
+	// Set when the command could not be run at all
+	err error
+	// Measurements of native runners
+	data map[string]any
+	// Full output of a truncated command, with --spill-output
+	outputFile string
+}
+
+// runCommand runs c, built with ctx, for the check called name and collects
+// its outcome; c is killed when ctx is done.
+func runCommand(ctx context.Context, name string, c *exec.Cmd) commandResult {
+	c.WaitDelay = commandWaitDelay
+	killProcessGroup(c)
+	capture := newOutputCapture(name)
+	c.Stdout, c.Stderr = capture.writers()
+	err := c.Run()
+	spillPath := capture.finish()
+	out := capture.combined.String(spillPath)
+	res := commandResult{
+		stdout:     strings.TrimSpace(capture.stdout.String(spillPath)),
+		stderr:     strings.TrimSpace(capture.stderr.String(spillPath)),
+		output:     strings.TrimSpace(out),
+		raw:        strings.TrimRightFunc(out, unicode.IsSpace),
+		outputFile: spillPath,
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		res.timedOut, res.exitCode = true, -1
+	case errors.As(err, &exitErr):
+		res.exitCode = exitErr.ExitCode()
+		// Killed by a signal, e.g. SIGXCPU at the cpu_time limit
+		if res.exitCode < 0 {
+			res.err = err
+		}
+	case err != nil:
+		res.err, res.exitCode = err, -1
+	}
+	return res
+}
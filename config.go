@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed packs/*.yaml
+var packs embed.FS
+
+// Built-in check packs of systems that don't use the Linux default.yaml
+var osPacks = map[string]string{
+	"darwin":  "darwin.yaml",
+	"freebsd": "bsd.yaml",
+	"openbsd": "bsd.yaml",
+	"windows": "windows.yaml",
+}
+
+// Config is the on-disk check definition file, in YAML or TOML.
+type Config struct {
+	// Set to false to start from an empty check set instead of the built-ins
+	Builtins *bool `yaml:"builtins" toml:"builtins"`
+	// Optional built-in packs added to the check set, e.g. cis
+	Packs []string `yaml:"packs" toml:"packs"`
+	// Names of built-in (or earlier) checks to drop
+	Disable []string              `yaml:"disable" toml:"disable"`
+	Vars    map[string]any        `yaml:"vars" toml:"vars"`
+	Secrets map[string]SecretSpec `yaml:"secrets" toml:"secrets"`
+	// TUI colors for --theme custom
+	Theme  *Theme  `yaml:"theme" toml:"theme"`
+	Checks []Check `yaml:"checks" toml:"checks"`
+
+	// Where each entry in Checks was defined
+	origins []origin
+}
+
+// origin is the file and line a check was defined at. Line is 0 when unknown.
+type origin struct {
+	path string
+	line int
+}
+
+// configError is a single problem found in a config file.
+type configError struct {
+	Path    string
+	Line    int
+	Check   string
+	Message string
+}
+
+func (e configError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Path)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+	}
+	b.WriteString(": ")
+	if e.Check != "" {
+		fmt.Fprintf(&b, "check %q: ", e.Check)
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// parseConfig decodes a check config, picking the decoder from the file
+// extension. Unknown keys are rejected so typos don't go unnoticed.
+func parseConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigData(path, data)
+}
+
+// parseConfigData decodes config data; path is used for the format and in
+// error messages.
+func parseConfigData(path string, data []byte) (*Config, error) {
+	var cfg Config
+	var err error
+	var lines []int
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		lines, err = parseYAML(data, &cfg)
+	case ".toml":
+		lines, err = parseTOML(data, &cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	cfg.origins = make([]origin, len(cfg.Checks))
+	for i := range cfg.origins {
+		cfg.origins[i].path = path
+		if i < len(lines) {
+			cfg.origins[i].line = lines[i]
+		}
+	}
+	return &cfg, nil
+}
+
+// parseYAML decodes data into cfg and returns the line of each check.
+func parseYAML(data []byte, cfg *Config) ([]int, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+
+	var lines []int
+	doc := root.Content[0]
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "checks" {
+			for _, item := range doc.Content[i+1].Content {
+				lines = append(lines, item.Line)
+			}
+		}
+	}
+	return lines, nil
+}
+
+// parseTOML decodes data into cfg and returns the line of each check.
+func parseTOML(data []byte, cfg *Config) ([]int, error) {
+	md, err := toml.Decode(string(data), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %q", undecoded[0].String())
+	}
+
+	// The TOML decoder doesn't expose key positions, but every check starts
+	// with a [[checks]] header.
+	var lines []int
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "[[checks]]" {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines, nil
+}
+
+// origin returns where the i-th check was defined.
+func (c *Config) origin(i int) origin {
+	if i < len(c.origins) {
+		return c.origins[i]
+	}
+	return origin{}
+}
+
+// builtinConfig returns the embedded check pack for the system kumo was
+// built for.
+func builtinConfig() *Config {
+	name, ok := osPacks[runtime.GOOS]
+	if !ok {
+		name = "default.yaml"
+	}
+	cfg, err := packConfig(name)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// optionalPacks lists the embedded packs that a config adds with "packs"
+// or --pack, rather than being chosen for the system.
+func optionalPacks() []string {
+	entries, _ := packs.ReadDir("packs")
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		osPack := name == "default.yaml"
+		for _, file := range osPacks {
+			osPack = osPack || name == file
+		}
+		if !osPack {
+			names = append(names, strings.TrimSuffix(name, ".yaml"))
+		}
+	}
+	return names
+}
+
+// packConfig parses the embedded pack file name.
+func packConfig(name string) (*Config, error) {
+	data, err := packs.ReadFile("packs/" + name)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigData("builtin:"+name, data)
+}
+
+// merge adds the vars and checks of other to c. Vars and checks with the
+// same name as ones already in c replace them, checks in place; the rest are
+// appended, so duplicate checks within other are kept for validateConfig to
+// report.
+func (c *Config) merge(other *Config) {
+	if other.Builtins != nil {
+		c.Builtins = other.Builtins
+	}
+	c.Packs = append(c.Packs, other.Packs...)
+	c.Disable = append(c.Disable, other.Disable...)
+	for k, v := range other.Secrets {
+		if c.Secrets == nil {
+			c.Secrets = make(map[string]SecretSpec)
+		}
+		c.Secrets[k] = v
+	}
+	if other.Theme != nil {
+		merged := Theme{}
+		if c.Theme != nil {
+			merged = *c.Theme
+		}
+		merged = merged.overlay(*other.Theme)
+		c.Theme = &merged
+	}
+
+	for k, v := range other.Vars {
+		if c.Vars == nil {
+			c.Vars = make(map[string]any)
+		}
+		c.Vars[k] = v
+	}
+
+	index := make(map[string]int, len(c.Checks))
+	for i, check := range c.Checks {
+		index[check.Name] = i
+	}
+	for i, check := range other.Checks {
+		if j, ok := index[check.Name]; ok && check.Name != "" {
+			c.Checks[j] = check
+			c.origins[j] = other.origin(i)
+			continue
+		}
+		c.Checks = append(c.Checks, check)
+		c.origins = append(c.origins, other.origin(i))
+	}
+}
+
+// configDirFiles lists the config files in dir in lexical order.
+func configDirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".toml":
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no config files found", dir)
+	}
+	return files, nil
+}
+
+// parseConfigDir parses every config file in dir in lexical order and merges
+// them, so later files override checks of the same name from earlier ones.
+func parseConfigDir(dir string) (*Config, error) {
+	files, err := configDirFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &Config{}
+	for _, file := range files {
+		cfg, err := parseConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		merged.merge(cfg)
+	}
+	return merged, nil
+}
+
+// validateConfig reports every problem in cfg: missing required fields,
+// invalid values, duplicate names and unknown or cyclic dependencies. path
+// names the config as a whole, for problems not tied to a single check.
+func validateConfig(path string, cfg *Config) []configError {
+	var errs []configError
+	report := func(i int, check, format string, args ...any) {
+		o := cfg.origin(i)
+		errs = append(errs, configError{Path: o.path, Line: o.line, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for name, spec := range cfg.Secrets {
+		if err := spec.validate(); err != nil {
+			errs = append(errs, configError{Path: path, Message: fmt.Sprintf("secret %s: %v", name, err)})
+		}
+	}
+	if cfg.Theme != nil {
+		if err := cfg.Theme.validate(); err != nil {
+			errs = append(errs, configError{Path: path, Message: fmt.Sprintf("theme: %v", err)})
+		}
+	}
+
+	if len(cfg.Checks) == 0 {
+		errs = append(errs, configError{Path: path, Message: "no checks defined"})
+		return errs
+	}
+
+	index := make(map[string]int, len(cfg.Checks))
+	for i, check := range cfg.Checks {
+		if check.Name == "" {
+			report(i, "", "check #%d has no name", i+1)
+			continue
+		}
+		switch {
+		case check.Cmd == "" && check.Native == "":
+			report(i, check.Name, "missing cmd")
+		case check.Cmd != "" && check.Native != "":
+			report(i, check.Name, "cmd and native are mutually exclusive")
+		case check.Native != "" && nativeRunners[check.Native] == nil:
+			report(i, check.Name, "unknown native check %q (use %s)", check.Native, nativeNames())
+		case check.Native == "" && len(check.Args) > 0:
+			report(i, check.Name, "args need a native check")
+		}
+		if check.Timeout < 0 || check.CacheTTL < 0 {
+			report(i, check.Name, "timeout and cache_ttl must not be negative")
+		}
+		if check.Retries < 0 || check.RetryDelay < 0 {
+			report(i, check.Name, "retries and retry_delay must not be negative")
+		}
+		if _, ok := severityRanks[check.severity()]; !ok {
+			report(i, check.Name, "unknown severity %q (use info, warning or critical)", check.Severity)
+		}
+		if _, ok := priorityRanks[check.Priority]; check.Priority != "" && !ok {
+			report(i, check.Name, "unknown priority %q (use high, normal or low)", check.Priority)
+		}
+		if _, err := parseCommandTemplate(check.Name, check.Cmd); err != nil {
+			report(i, check.Name, "cmd: %v", err)
+		}
+		if _, err := parseCommandTemplate(check.Name, check.When); err != nil {
+			report(i, check.Name, "when: %v", err)
+		}
+		for name, arg := range check.Args {
+			if _, err := parseCommandTemplate(check.Name, arg); err != nil {
+				report(i, check.Name, "args: %s: %v", name, err)
+			}
+		}
+		for name, value := range check.Env {
+			if !envNamePattern.MatchString(name) {
+				report(i, check.Name, "env: invalid variable name %q", name)
+			}
+			if _, err := parseCommandTemplate(check.Name, value); err != nil {
+				report(i, check.Name, "env: %s: %v", name, err)
+			}
+		}
+		if check.Native != "" && (len(check.Env) > 0 || check.InheritEnv != nil || check.Shell != "" || check.Dir != "" || check.User != "" || check.Sandbox != nil && *check.Sandbox || check.Limits != nil) {
+			report(i, check.Name, "env, inherit_env, shell, dir, user, sandbox and limits need a cmd")
+		}
+		if check.Limits != nil {
+			for _, problem := range check.Limits.validate() {
+				report(i, check.Name, "limits: %s", problem)
+			}
+		}
+		if check.Shell != "" && !slices.Contains(checkShells, check.Shell) {
+			report(i, check.Name, "unknown shell %q (use bash, sh, powershell, cmd or none)", check.Shell)
+		}
+		if check.Shell == "none" {
+			if _, err := splitArgs(check.Cmd); err != nil {
+				report(i, check.Name, "cmd: %v", err)
+			}
+		}
+		if check.Privileged && check.User != "" {
+			report(i, check.Name, "privileged and user are mutually exclusive")
+		}
+		for field, value := range map[string]string{"dir": check.Dir, "user": check.User} {
+			if _, err := parseCommandTemplate(check.Name, value); err != nil {
+				report(i, check.Name, "%s: %v", field, err)
+			}
+		}
+		if check.When != "" {
+			if _, err := parseCondition(check.When); err != nil {
+				report(i, check.Name, "when: %v", err)
+			}
+		}
+		for _, name := range check.Secrets {
+			if _, ok := cfg.Secrets[name]; !ok {
+				report(i, check.Name, "uses undefined secret %q", name)
+			}
+		}
+		for _, problem := range check.Assert.validate() {
+			report(i, check.Name, "assert: %s", problem)
+		}
+		if first, ok := index[check.Name]; ok {
+			o := cfg.origin(first)
+			report(i, check.Name, "duplicate name (first defined at %s:%d)", o.path, o.line)
+			continue
+		}
+		index[check.Name] = i
+	}
+
+	for i, check := range cfg.Checks {
+		for _, dep := range check.DependsOn {
+			if _, ok := index[dep]; !ok {
+				report(i, check.Name, "depends on unknown check %q", dep)
+			}
+		}
+	}
+	if cycle := findCycle(cfg.Checks); cycle != nil {
+		report(index[cycle[0]], cycle[0], "dependency cycle: %s", formatCycle(cycle))
+	}
+
+	return errs
+}
+
+// assembleConfig layers user over the built-in checks, unless it opts out
+// with "builtins: false", and the optional packs it or --pack adds, removes
+// the checks it disables and validates the result. path names the user
+// config in error messages.
+func assembleConfig(path string, user *Config) (*Config, []configError) {
+	cfg := &Config{}
+	if user.Builtins == nil || *user.Builtins {
+		cfg.merge(builtinConfig())
+	}
+	var errs []configError
+	var added []string
+	for _, name := range append(slices.Clone(user.Packs), extraPacks...) {
+		if slices.Contains(added, name) {
+			continue
+		}
+		added = append(added, name)
+		if !slices.Contains(optionalPacks(), name) {
+			errs = append(errs, configError{Path: path, Message: fmt.Sprintf("packs: unknown pack %q (available: %s)", name, strings.Join(optionalPacks(), ", "))})
+			continue
+		}
+		pack, err := packConfig(name + ".yaml")
+		if err != nil {
+			panic(err)
+		}
+		cfg.merge(pack)
+	}
+	cfg.merge(user)
+	cfg.Packs = nil
+
+	for _, name := range user.Disable {
+		i := slices.IndexFunc(cfg.Checks, func(c Check) bool { return c.Name == name })
+		if i < 0 {
+			errs = append(errs, configError{Path: path, Message: fmt.Sprintf("disable: unknown check %q", name)})
+			continue
+		}
+		cfg.Checks = slices.Delete(cfg.Checks, i, i+1)
+		cfg.origins = slices.Delete(cfg.origins, i, i+1)
+	}
+	cfg.Disable = nil
+
+	return cfg, append(errs, validateConfig(path, cfg)...)
+}
+
+// loadConfig parses the config file at path and the config files in dir,
+// either of which may be empty, merges them in that order on top of the
+// built-in checks and validates the result.
+func loadConfig(path, dir string) (*Config, error) {
+	user := &Config{}
+	if path != "" {
+		parsed, err := parseConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		user.merge(parsed)
+	}
+	if dir != "" {
+		parsed, err := parseConfigDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		user.merge(parsed)
+	}
+
+	cfg, errs := assembleConfig(strings.Trim(path+" "+dir, " "), user)
+	if len(errs) > 0 {
+		joined := make([]error, len(errs))
+		for i, e := range errs {
+			joined[i] = e
+		}
+		return nil, errors.Join(joined...)
+	}
+	return cfg, nil
+}
+
+// loadChecks returns the built-in checks merged with the config file at path
+// and the config directory dir, both optional, as a config ready to run.
+// Commands, conditions, native args, env values, dirs and users are rendered
+// as templates with the config's vars, then ${VAR} references in commands,
+// args, env values and dirs are expanded from env and the environment.
+// defines override both the config's vars and env.
+func loadChecks(path, dir string, env, defines map[string]string) (*Config, error) {
+	cfg, err := loadConfig(path, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string, len(env)+len(defines))
+	for k, v := range env {
+		vars[k] = v
+	}
+	for k, v := range defines {
+		if cfg.Vars == nil {
+			cfg.Vars = make(map[string]any)
+		}
+		cfg.Vars[k] = v
+		vars[k] = v
+	}
+
+	for i := range cfg.Checks {
+		check := &cfg.Checks[i]
+		cmd, err := renderCommand(check.Name, check.Cmd, cfg.Vars)
+		if err == nil {
+			check.When, err = renderCommand(check.Name, check.When, cfg.Vars)
+		}
+		if err == nil {
+			check.Args, err = renderValues(check.Name, "args", check.Args, cfg.Vars, vars)
+		}
+		if err == nil {
+			check.Env, err = renderValues(check.Name, "env", check.Env, cfg.Vars, vars)
+		}
+		if err == nil {
+			check.Dir, err = renderCommand(check.Name, check.Dir, cfg.Vars)
+		}
+		if err == nil {
+			check.User, err = renderCommand(check.Name, check.User, cfg.Vars)
+		}
+		if err != nil {
+			o := cfg.origin(i)
+			return nil, configError{Path: o.path, Line: o.line, Check: check.Name, Message: err.Error()}
+		}
+		check.Cmd = expandEnv(cmd, vars)
+		check.Dir = expandEnv(check.Dir, vars)
+		for _, name := range check.Secrets {
+			if check.secretSpecs == nil {
+				check.secretSpecs = make(map[string]SecretSpec)
+			}
+			check.secretSpecs[name] = cfg.Secrets[name]
+		}
+	}
+	return cfg, nil
+}
+
+// renderValues renders the values of a check's args or env, named field,
+// like its command. The map is copied, as merged configs share it with the
+// config they came from.
+func renderValues(check, field string, values map[string]string, vars map[string]any, env map[string]string) (map[string]string, error) {
+	if len(values) == 0 {
+		return values, nil
+	}
+	rendered := make(map[string]string, len(values))
+	for name, value := range values {
+		v, err := renderCommand(check, value, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", field, name, err)
+		}
+		rendered[name] = expandEnv(v, env)
+	}
+	return rendered, nil
+}
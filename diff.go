@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reportDiff is what changed between two reports.
+type reportDiff struct {
+	Changed []statusChange  `json:"changed"`
+	Added   []CheckResult   `json:"added"`
+	Removed []CheckResult   `json:"removed"`
+	Slower  []durationDelta `json:"slower"`
+}
+
+type statusChange struct {
+	Name      string `json:"name"`
+	OldStatus string `json:"old_status"`
+	NewStatus string `json:"new_status"`
+}
+
+type durationDelta struct {
+	Name        string  `json:"name"`
+	OldDuration float64 `json:"old_duration_seconds"`
+	NewDuration float64 `json:"new_duration_seconds"`
+}
+
+func (d *reportDiff) empty() bool {
+	return len(d.Changed) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Slower) == 0
+}
+
+// runDiff implements "kumo diff": it compares two saved reports and returns
+// 0 when nothing changed, 1 when something did and 2 on errors, like diff(1).
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "write the differences as JSON")
+	factor := fs.Float64("slowdown", 1.5, "report checks that got at least this many times slower")
+	minDelta := fs.Duration("min-slowdown", 500*time.Millisecond, "ignore slowdowns smaller than this")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: kumo diff [flags] OLD NEW")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	old, err := readReportFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	updated, err := readReportFile(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	diff := diffResults(old, updated, *factor, minDelta.Seconds())
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(diff)
+	} else {
+		writeDiff(os.Stdout, diff)
+	}
+
+	if diff.empty() {
+		return 0
+	}
+	return 1
+}
+
+// readReportFile reads the results from a JSON or YAML report: either a
+// bare results array, as written by --output json, or a full report.
+func readReportFile(path string) ([]CheckResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON, so one decoder handles both
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("parse %s: empty report", path)
+	}
+
+	var results []CheckResult
+	if doc.Content[0].Kind == yaml.SequenceNode {
+		err = doc.Content[0].Decode(&results)
+	} else {
+		var report Report
+		err = doc.Content[0].Decode(&report)
+		results = report.Results
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return results, nil
+}
+
+// diffResults compares two runs by check name. A check counts as slower
+// when it took at least factor times as long and minDelta seconds more.
+func diffResults(old, updated []CheckResult, factor, minDelta float64) *reportDiff {
+	diff := &reportDiff{
+		Changed: []statusChange{},
+		Added:   []CheckResult{},
+		Removed: []CheckResult{},
+		Slower:  []durationDelta{},
+	}
+
+	before := make(map[string]CheckResult, len(old))
+	for _, r := range old {
+		before[r.Name] = r
+	}
+	seen := make(map[string]bool, len(updated))
+	for _, r := range updated {
+		seen[r.Name] = true
+		prev, ok := before[r.Name]
+		if !ok {
+			diff.Added = append(diff.Added, r)
+			continue
+		}
+		if prev.Status != r.Status {
+			diff.Changed = append(diff.Changed, statusChange{r.Name, prev.Status, r.Status})
+		}
+		if r.Duration-prev.Duration >= minDelta && r.Duration >= prev.Duration*factor {
+			diff.Slower = append(diff.Slower, durationDelta{r.Name, prev.Duration, r.Duration})
+		}
+	}
+	for _, r := range old {
+		if !seen[r.Name] {
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+	return diff
+}
+
+func writeDiff(w io.Writer, diff *reportDiff) {
+	if diff.empty() {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+	if len(diff.Changed) > 0 {
+		fmt.Fprintln(w, "Changed:")
+		for _, c := range diff.Changed {
+			fmt.Fprintf(w, "  %s: %s -> %s\n", c.Name, c.OldStatus, c.NewStatus)
+		}
+	}
+	if len(diff.Added) > 0 {
+		fmt.Fprintln(w, "Added:")
+		for _, r := range diff.Added {
+			fmt.Fprintf(w, "  + %s (%s)\n", r.Name, r.Status)
+		}
+	}
+	if len(diff.Removed) > 0 {
+		fmt.Fprintln(w, "Removed:")
+		for _, r := range diff.Removed {
+			fmt.Fprintf(w, "  - %s (%s)\n", r.Name, r.Status)
+		}
+	}
+	if len(diff.Slower) > 0 {
+		fmt.Fprintln(w, "Slower:")
+		for _, d := range diff.Slower {
+			fmt.Fprintf(w, "  %s: %.2fs -> %.2fs\n", d.Name, d.OldDuration, d.NewDuration)
+		}
+	}
+}
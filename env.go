@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Matches ${NAME}. Bare $NAME is left alone so shell snippets such as awk
+// field references keep working.
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Names allowed in a check's env
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// environ returns the environment of the check's command: kumo's own unless
+// inherit_env is false, then the check's env and the secrets given as
+// KEY=VALUE, later entries winning.
+func (c Check) environ(secrets []string) []string {
+	var env []string
+	if c.InheritEnv == nil || *c.InheritEnv {
+		env = os.Environ()
+	}
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		env = append(env, name+"="+c.Env[name])
+	}
+	return append(env, secrets...)
+}
+
+// expandEnv replaces ${NAME} references in s with values from vars, falling
+// back to the process environment. Unknown references are left untouched so
+// the shell still sees them.
+func expandEnv(s string, vars map[string]string) string {
+	return envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRefPattern.FindStringSubmatch(ref)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		return ref
+	})
+}
+
+// loadEnvFile parses a dotenv-style file of KEY=VALUE lines. Blank lines,
+// "#" comments and a leading "export " are allowed, and values may be
+// single- or double-quoted.
+func loadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// envNames lists the variables the check sets, its env and the secrets
+// given as KEY=VALUE, sorted.
+func (c Check) envNames(secrets []string) []string {
+	var names []string
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	for _, kv := range secrets {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressEvent is a line of --progress-events output: a check started or
+// finished, with how far the run has got.
+type progressEvent struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Check     string    `json:"check"`
+	Status    string    `json:"status,omitempty"`
+	Duration  *float64  `json:"duration_seconds,omitempty"`
+	Completed int       `json:"completed"`
+	Total     int       `json:"total"`
+	Percent   float64   `json:"percent"`
+}
+
+// headlessProgress returns the progress of a run without the TUI: events on
+// stderr with --progress-events, or nothing.
+func headlessProgress(checks []Check) progress {
+	if !progressEvents {
+		return progress{}
+	}
+	return eventProgress(os.Stderr, checks)
+}
+
+// eventProgress writes the progress of checks to w as JSON lines.
+func eventProgress(w io.Writer, checks []Check) progress {
+	var mutex sync.Mutex
+	enc := json.NewEncoder(w)
+	completed := 0
+	emit := func(event progressEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if event.Event == "finished" {
+			completed++
+		}
+		event.Time = time.Now().UTC()
+		event.Completed, event.Total = completed, len(checks)
+		event.Percent = 100
+		if len(checks) > 0 {
+			event.Percent = math.Round(float64(completed)*1000/float64(len(checks))) / 10
+		}
+		enc.Encode(event)
+	}
+	return progress{
+		started: func(i int) {
+			emit(progressEvent{Event: "started", Check: checks[i].Name})
+		},
+		finished: func(i int, result CheckResult) {
+			emit(progressEvent{Event: "finished", Check: result.Name, Status: result.Status, Duration: &result.Duration})
+		},
+	}
+}
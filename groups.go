@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// resultGroup is a collapsible section of the grouped results list.
+type resultGroup struct {
+	name    string
+	results []CheckResult
+}
+
+// listRow is one selectable line of the results list: a check, or in the
+// grouped view the header of a group.
+type listRow struct {
+	result CheckResult
+	group  *resultGroup // set on header rows
+}
+
+// groupName files a result under the first profile of its check, else its
+// first tag. Skipped rows and checks without either get their own groups.
+func (m model) groupName(result CheckResult) string {
+	if result.Status == statusSkipped {
+		return "skipped"
+	}
+	check := m.checkFor(result)
+	switch {
+	case len(check.Profiles) > 0:
+		return check.Profiles[0]
+	case len(check.Tags) > 0:
+		return check.Tags[0]
+	}
+	return "other"
+}
+
+// groupResults splits results into groups, ordered by their first result.
+func (m model) groupResults(results []CheckResult) []resultGroup {
+	var groups []resultGroup
+	index := make(map[string]int)
+	for _, result := range results {
+		name := m.groupName(result)
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, resultGroup{name: name})
+		}
+		groups[i].results = append(groups[i].results, result)
+	}
+	return groups
+}
+
+// grouped reports whether the list shows groups: unless switched off with
+// "z", whenever the checks fall into more than one.
+func (m model) grouped(groups []resultGroup) bool {
+	return !m.flat && len(groups) > 1
+}
+
+// rows lists the results as shown: in display order, or grouped with the
+// checks of collapsed groups left out.
+func (m model) rows() []listRow {
+	visible := m.visibleResults()
+	groups := m.groupResults(visible)
+	var rows []listRow
+	if !m.grouped(groups) {
+		for _, result := range visible {
+			rows = append(rows, listRow{result: result})
+		}
+		return rows
+	}
+	for i := range groups {
+		rows = append(rows, listRow{group: &groups[i]})
+		if m.collapsed[groups[i].name] {
+			continue
+		}
+		for _, result := range groups[i].results {
+			rows = append(rows, listRow{result: result})
+		}
+	}
+	return rows
+}
+
+// title renders the group header, e.g. "▾ Security (2 failed)".
+func (g *resultGroup) title(collapsed, selected bool) string {
+	var failed, running, passed, skipped int
+	for _, result := range g.results {
+		switch result.Status {
+		case statusFailed, statusTimedOut:
+			failed++
+		case statusRunning:
+			running++
+		case statusPassed:
+			passed++
+		case statusSkipped, statusCancelled:
+			skipped++
+		}
+	}
+
+	var counts []string
+	style := successStyle
+	if failed > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", failed))
+		style = errorStyle
+	}
+	if running > 0 {
+		counts = append(counts, fmt.Sprintf("%d running", running))
+		if failed == 0 {
+			style = loadingStyle
+		}
+	}
+	if len(counts) == 0 {
+		if passed > 0 {
+			counts = append(counts, fmt.Sprintf("%d passed", passed))
+		}
+		if skipped > 0 {
+			counts = append(counts, fmt.Sprintf("%d skipped", skipped))
+			if passed == 0 {
+				style = skippedStyle
+			}
+		}
+	}
+
+	arrow := "▾"
+	if collapsed {
+		arrow = "▸"
+	}
+	r, size := utf8.DecodeRuneInString(g.name)
+	name := string(unicode.ToUpper(r)) + g.name[size:]
+	return style.Bold(true).Reverse(selected).Render(fmt.Sprintf("%s %s (%s)", arrow, name, strings.Join(counts, ", ")))
+}
+
+// renderGroups lays out the grouped results list, with the row at selected
+// marked and messages fitted to width, and returns the row drawn on each
+// line like renderResultLines.
+func (m model) renderGroups(rows []listRow, spinner string, selected, width int) (string, []int) {
+	var results []CheckResult
+	for _, row := range rows {
+		if row.group == nil {
+			results = append(results, row.result)
+		}
+	}
+	table := newResultTable(results, spinner, m.raw, width)
+	table.line(titleStyle.Render("System Check Results:"))
+	table.line("")
+	for i, row := range rows {
+		marker := "  "
+		if i == selected {
+			marker = selectedMarker
+		}
+		if row.group != nil {
+			table.header(i, marker+row.group.title(m.collapsed[row.group.name], i == selected))
+			continue
+		}
+		table.row(i, marker+"  ", row.result, i == selected)
+	}
+	return table.view.String(), table.rows
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// keyMap is every TUI keybinding. Update matches key presses against it and
+// the footer hints and the help screen are generated from it.
+type keyMap struct {
+	Up, Down, Details, Back                   key.Binding
+	Filter, ClearFilter, Sort, Reverse, Rerun key.Binding
+	Flat, Raw                                 key.Binding
+	LineUp, LineDown, PageDown, PageUp        key.Binding
+	HalfDown, HalfUp, Top, Bottom             key.Binding
+	Copy, Pager, Help, Quit                   key.Binding
+}
+
+var keys = keyMap{
+	Up:          key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "previous check")),
+	Down:        key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "next check")),
+	Details:     key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "details or fold group")),
+	Back:        key.NewBinding(key.WithKeys("esc", "enter", "backspace"), key.WithHelp("esc", "back")),
+	Filter:      key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "filter")),
+	ClearFilter: key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "clear filter")),
+	Sort:        key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "sort")),
+	Reverse:     key.NewBinding(key.WithKeys("S"), key.WithHelp("S", "reverse sort")),
+	Rerun:       key.NewBinding(key.WithKeys("R"), key.WithHelp("R", "rerun")),
+	Raw:         key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "raw or formatted output")),
+	Flat:        key.NewBinding(key.WithKeys("z"), key.WithHelp("z", "group or flat list")),
+	LineUp:      key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "scroll up")),
+	LineDown:    key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "scroll down")),
+	PageDown:    key.NewBinding(key.WithKeys("pgdown", " ", "f"), key.WithHelp("pgdn/space", "page down")),
+	PageUp:      key.NewBinding(key.WithKeys("pgup", "b"), key.WithHelp("pgup/b", "page up")),
+	HalfDown:    key.NewBinding(key.WithKeys("ctrl+d"), key.WithHelp("ctrl+d", "half page down")),
+	HalfUp:      key.NewBinding(key.WithKeys("ctrl+u"), key.WithHelp("ctrl+u", "half page up")),
+	Top:         key.NewBinding(key.WithKeys("home", "g"), key.WithHelp("home/g", "top")),
+	Bottom:      key.NewBinding(key.WithKeys("end", "G"), key.WithHelp("end/G", "bottom")),
+	Copy:        key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "copy output")),
+	Pager:       key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "page output")),
+	Help:        key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "help")),
+	Quit:        key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
+}
+
+// Sections of the help screen
+var helpSections = []struct {
+	title    string
+	bindings []key.Binding
+}{
+	{"Results", []key.Binding{keys.Up, keys.Down, keys.Details, keys.Raw, keys.Copy, keys.Pager, keys.Filter, keys.ClearFilter, keys.Sort, keys.Reverse, keys.Flat, keys.Rerun}},
+	{"Details", []key.Binding{keys.LineUp, keys.LineDown, keys.Copy, keys.Pager, keys.Back}},
+	{"Scrolling", []key.Binding{keys.PageDown, keys.PageUp, keys.HalfDown, keys.HalfUp, keys.Top, keys.Bottom}},
+	{"General", []key.Binding{keys.Help, keys.Quit}},
+}
+
+// shortHelp renders the footer hint for bindings, e.g. "q quit • / filter".
+func shortHelp(bindings ...key.Binding) string {
+	hints := make([]string, len(bindings))
+	for i, b := range bindings {
+		hints[i] = b.Help().Key + " " + b.Help().Desc
+	}
+	return strings.Join(hints, " • ")
+}
+
+// renderHelp lists every keybinding and the flags in effect for this run.
+func (m model) renderHelp() string {
+	var view strings.Builder
+	w := tabwriter.NewWriter(&view, 0, 0, 3, ' ', 0)
+	for _, section := range helpSections {
+		fmt.Fprintln(w, titleStyle.Render(section.title))
+		for _, b := range section.bindings {
+			fmt.Fprintf(w, "    %s\t%s\n", b.Help().Key, b.Help().Desc)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	view.WriteString(titleStyle.Render("Settings") + "\n")
+	w = tabwriter.NewWriter(&view, 0, 0, 3, ' ', 0)
+	for _, setting := range m.settings() {
+		fmt.Fprintf(w, "    %s\t%s\n", setting[0], setting[1])
+	}
+	w.Flush()
+	return view.String()
+}
+
+// settings lists the flags that shaped this run, leaving out unset filters.
+func (m model) settings() [][2]string {
+	config := "built-in checks"
+	if configPath != "" || configDir != "" {
+		config = strings.Trim(configPath+" "+configDir, " ")
+	}
+	settings := [][2]string{{"Config", config}}
+	for _, filter := range []struct {
+		name   string
+		values listFlag
+	}{
+		{"Profiles", profiles},
+		{"Tags", tags},
+		{"Skip tags", skipTags},
+		{"Only", onlyChecks},
+		{"Exclude", excludeNames},
+	} {
+		if len(filter.values) > 0 {
+			settings = append(settings, [2]string{filter.name, strings.Join(filter.values, ", ")})
+		}
+	}
+	if len(defines) > 0 {
+		settings = append(settings, [2]string{"Variables", defines.String()})
+	}
+	settings = append(settings,
+		[2]string{"Checks", fmt.Sprintf("%d to run, %d skipped", len(m.checks), len(m.skipped))},
+		[2]string{"Sort", m.sortName()},
+		[2]string{"Fail on", failOn},
+		[2]string{"Theme", activeTheme},
+	)
+	return settings
+}
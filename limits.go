@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceLimits cap what a check's command may use, so that a misbehaving
+// check can't starve the workload of the host it audits.
+type ResourceLimits struct {
+	// CPU time after which the command is killed
+	CPUTime time.Duration `yaml:"cpu_time,omitempty" toml:"cpu_time"`
+	// Memory the command may use, e.g. "512M"; its address space, or in the
+	// sandbox the memory of the whole unit
+	Memory string `yaml:"memory,omitempty" toml:"memory"`
+	// Scheduling niceness from 1 to 19, lower than kumo's own priority
+	Nice int `yaml:"nice,omitempty" toml:"nice"`
+}
+
+var byteSizePattern = regexp.MustCompile(`^(?i)(\d+)\s*([KMGT]?)(?:i?B)?$`)
+
+// Shifts of the binary units of a size
+var byteSizeShifts = map[string]int{"": 0, "K": 10, "M": 20, "G": 30, "T": 40}
+
+// parseByteSize parses a size like "512M", "2GiB" or "1048576" in binary
+// units.
+func parseByteSize(s string) (uint64, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("%q is not a size like 512M", s)
+	}
+	n, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	shift := byteSizeShifts[strings.ToUpper(m[2])]
+	if shift > 0 && n > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("%q is too large", s)
+	}
+	return n << shift, nil
+}
+
+// validate reports what is wrong with the limits.
+func (l *ResourceLimits) validate() []string {
+	var problems []string
+	if l.CPUTime < 0 {
+		problems = append(problems, "cpu_time must not be negative")
+	}
+	if l.Memory != "" {
+		if n, err := parseByteSize(l.Memory); err != nil {
+			problems = append(problems, "memory: "+err.Error())
+		} else if n < 1<<20 {
+			problems = append(problems, "memory must be at least 1M")
+		}
+	}
+	if l.Nice < 0 || l.Nice > 19 {
+		problems = append(problems, "nice must be between 0 and 19")
+	}
+	return problems
+}
+
+// cpuSeconds is the CPU time limit in whole seconds, rounded up.
+func (l *ResourceLimits) cpuSeconds() int64 {
+	return int64(math.Ceil(l.CPUTime.Seconds()))
+}
+
+// wrap returns argv run under the limits: through sh, which sets them with
+// ulimit and nice before it execs the command. Without limits argv is
+// returned as is.
+func (l *ResourceLimits) wrap(argv []string) ([]string, error) {
+	if l == nil || *l == (ResourceLimits{}) {
+		return argv, nil
+	}
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("limits are not supported on windows")
+	}
+	var script []string
+	if l.CPUTime > 0 {
+		script = append(script, fmt.Sprintf("ulimit -t %d", l.cpuSeconds()))
+	}
+	if l.Memory != "" {
+		n, _ := parseByteSize(l.Memory)
+		script = append(script, fmt.Sprintf("ulimit -v %d", n>>10))
+	}
+	if l.Nice > 0 {
+		script = append(script, fmt.Sprintf(`exec nice -n %d "$@"`, l.Nice))
+	} else {
+		script = append(script, `exec "$@"`)
+	}
+	return append([]string{"sh", "-c", strings.Join(script, " && "), "kumo"}, argv...), nil
+}
+
+// properties returns the limits as systemd unit properties for the
+// sandbox, where memory is enforced by the unit's cgroup.
+func (l *ResourceLimits) properties() []string {
+	if l == nil {
+		return nil
+	}
+	var properties []string
+	if l.CPUTime > 0 {
+		properties = append(properties, fmt.Sprintf("LimitCPU=%d", l.cpuSeconds()))
+	}
+	if l.Memory != "" {
+		n, _ := parseByteSize(l.Memory)
+		properties = append(properties, fmt.Sprintf("MemoryMax=%d", n), "MemorySwapMax=0")
+	}
+	if l.Nice > 0 {
+		properties = append(properties, fmt.Sprintf("Nice=%d", l.Nice))
+	}
+	return properties
+}
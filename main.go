@@ -1,17 +1,18 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
-	"os/exec"
+	"runtime"
+	"slices"
 	"strings"
-	"sync"
-	"text/tabwriter"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,207 +20,335 @@ import (
 var log = logrus.New()
 
 // CLI flags
-var outputFormat string
-
-// Structure to hold system check results
-type CheckResult struct {
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
-}
-
-type model struct {
-	results  []CheckResult
-	quitting bool
-	spinner  int
-}
-
-// Tick message type for spinner animation
-type tickMsg time.Time
-
-// Visual styles
 var (
-	titleStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF79C6"))
-	successStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#50FA7B"))
-	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5555"))
-	loadingStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#F1FA8C")).Bold(true)
-	footerStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#6272A4")).Italic(true)
+	outputFormat   string
+	configPath     string
+	configDir      string
+	configSHA256   string
+	cacheDir       string
+	configPubKey   string
+	requireSigned  bool
+	envFile        string
+	profiles       listFlag
+	tags           listFlag
+	skipTags       listFlag
+	onlyChecks     listFlag
+	excludeNames   listFlag
+	extraPacks     listFlag
+	defines        = defineFlag{}
+	watchInterval  time.Duration
+	metricsFile    string
+	metricsAddr    string
+	templatePath   string
+	reportDir      string
+	reportFormat   string
+	reportKeep     int
+	reportMaxAge   time.Duration
+	syslogTarget   string
+	noColor        bool
+	themeName      string
+	failOn         string
+	runTimeout     time.Duration
+	concurrency    int
+	sequential     bool
+	failFast       bool
+	progressEvents bool
+	useSudo        bool
+	useSandbox     bool
+	noCache        bool
+	maxOutputSize  int
+	spillOutput    bool
+	logFormat      string
+	logFile        string
+	signKeyPath    string
+	archivePath    string
 )
 
-// Spinner animation frames
-var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
-
-func runChecks() []CheckResult {
-	var wg sync.WaitGroup
-	results := make([]CheckResult, 0)
-	mutex := &sync.Mutex{}
-
-	checks := []struct {
-		Name    string
-		Cmd     string
-		ErrHint string
-	}{
-		{"System Update", "sudo apt update -y 2>/dev/null ", "Failed to fetch updates. Ensure apt is installed and configured."},
-		{"System Updateable", "sudo apt list --upgradable 2>/dev/null", "Failed to check for upgradable packages."},
-		{"Kernel Check", "uname -r", "Kernel information not available."},
-		{"UFW Firewall Status", "sudo ufw status | grep -q active", "UFW firewall is inactive or not installed."},
-		{"SSH Security", "grep -q 'PermitRootLogin no' /etc/ssh/sshd_config", "Root login over SSH is permitted. Update sshd_config."},
-		{"Disk Usage", "df -h > /dev/null", "Disk usage information could not be retrieved."},
-		{"Memory Usage", "free -m", "Memory usage data is unavailable."},
-		{"Service Status (rsyslog)", "systemctl is-active --quiet rsyslog", "rsyslog service is not active."},
-		{"Cron Jobs", "crontab -l", "No cron jobs found for the current user."},
-		{"TLS Support", "openssl ciphers -v | grep -q 'TLSv1.2\\|TLSv1.3'", "TLSv1.2 or TLSv1.3 support is missing."},
-		{"Password Policy", "grep -q 'minlen' /etc/security/pwquality.conf", "Password policy not enforced. Check pwquality.conf."},
-		{"Disk Encryption", "lsblk -o NAME,TYPE,SIZE,MOUNTPOINT,UUID,ENCRYPTION | grep -i crypt", "Disk encryption not enabled."},
-		{"Unnecessary Services", "systemctl list-units --type=service --state=running | grep -i 'unwanted-service'", "Unnecessary services are running."},
-	}
-
-	for _, check := range checks {
-		wg.Add(1)
-		go func(name, cmd, errHint string) {
-			defer wg.Done()
-			start := time.Now()
-			status, msg := runCommand(cmd)
-			if status == "Failed" {
-				msg = errHint + " (" + msg + ")"
-			}
-			elapsed := time.Since(start)
-
-			mutex.Lock()
-			results = append(results, CheckResult{
-				Name:    name,
-				Status:  status,
-				Message: fmt.Sprintf("%s (%.2fs)", msg, elapsed.Seconds()),
-			})
-			mutex.Unlock()
-		}(check.Name, check.Cmd, check.ErrHint)
-	}
-
-	wg.Wait()
-	return results
-}
+// Process exit codes
+const (
+	exitOK          = 0
+	exitFailed      = 1   // a check at or above --fail-on failed or timed out
+	exitError       = 2   // kumo itself could not run the checks
+	exitInterrupted = 130 // SIGINT or SIGTERM stopped the run, whose report is partial
+)
 
-func runCommand(cmd string) (string, string) {
-	out, err := exec.Command("bash", "-c", cmd).CombinedOutput()
-	if err != nil {
-		return "Failed", strings.TrimSpace(string(out))
+// exitStatus returns the exit code for a run: exitFailed if any check with
+// at least the given severity failed or timed out.
+func exitStatus(results []CheckResult, threshold string) int {
+	for _, r := range results {
+		if (r.Status == statusFailed || r.Status == statusTimedOut) && severityRanks[r.Severity] >= severityRanks[threshold] {
+			return exitFailed
+		}
 	}
-	return "Passed", strings.TrimSpace(string(out))
+	return exitOK
 }
 
-type checkResultsMsg []CheckResult
-
-type quitMsg struct{}
-
-func (m model) Init() tea.Cmd {
-	return func() tea.Msg {
-		return checkResultsMsg(runChecks())
+// exitCode returns the exit code for the report's run: exitInterrupted if a
+// signal stopped it, else its exitStatus for --fail-on.
+func (r *Report) exitCode() int {
+	if r.Interrupted {
+		return exitInterrupted
 	}
+	return exitStatus(r.Results, failOn)
 }
 
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case checkResultsMsg:
-		m.results = msg
-		return m, nil
-	case tea.KeyMsg:
-		if msg.String() == "q" {
-			return m, func() tea.Msg {
-				return quitMsg{}
-			}
-		}
-	case tickMsg:
-		m.spinner = (m.spinner + 1) % len(spinnerFrames)
-		return m, tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
-			return tickMsg(t)
-		})
-	case quitMsg:
-		m.quitting = true
-		return m, tea.Quit
-	}
-	return m, tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
-		return tickMsg(t)
-	})
+// Structure to hold system check results
+type CheckResult struct {
+	Name     string `json:"name" yaml:"name"`
+	Status   string `json:"status" yaml:"status"`
+	Severity string `json:"severity" yaml:"severity"`
+	Message  string `json:"message" yaml:"message"`
+	// Wall time in seconds, including retries
+	Duration float64 `json:"duration_seconds" yaml:"duration_seconds"`
+	// Set for checks that did not pass
+	Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+	// Compliance controls of the check
+	Controls []string `json:"controls,omitempty" yaml:"controls,omitempty"`
+	// Exit code of the last attempt's command, e.g. 127 when it was not
+	// found. Unset for checks that were skipped, timed out or could not be
+	// run at all.
+	ExitCode *int `json:"exit_code,omitempty" yaml:"exit_code,omitempty"`
+	// When the result was cached, for results reused from the cache
+	CachedAt *time.Time `json:"cached_at,omitempty" yaml:"cached_at,omitempty"`
+	// Temporary file with the full output of a command whose output was
+	// truncated, with --spill-output
+	OutputFile string `json:"output_file,omitempty" yaml:"output_file,omitempty"`
+	// What a native check measured, e.g. the sizes of each filesystem
+	Data map[string]any `json:"data,omitempty" yaml:"data,omitempty"`
+
+	// Raw output, interleaved as written, and each stream on its own of the
+	// last attempt, kept for --archive and the TUI detail view
+	output         string
+	stdout, stderr string
+	// When the check of a TUI row still running started executing; zero
+	// while it waits for its dependencies
+	started time.Time
 }
 
-func formatMessage(msg string) string {
-	parts := strings.Split(msg, " (")
-	if len(parts) != 2 {
-		return msg
-	}
+// registerRunFlags adds the flags that choose which checks run, shared by
+// every command that runs checks.
+func registerRunFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configPath, "config", "", "YAML or TOML file or https:// URL with check definitions")
+	fs.StringVar(&configSHA256, "config-sha256", "", "expected SHA-256 of the --config file; the run aborts on mismatch")
+	fs.StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "directory for cached remote configs and check results")
+	fs.IntVar(&maxOutputSize, "max-output-bytes", 64<<10, "keep at most this much of each check's output, truncating the rest")
+	fs.BoolVar(&spillOutput, "spill-output", false, "save the full output of truncated checks to a temporary file named in the result")
+	fs.BoolVar(&noCache, "no-cache", false, "run every check instead of reusing results cached with cache_ttl")
+	fs.BoolVar(&requireSigned, "require-signed-config", false, "refuse to run unless every config file has a valid minisign signature")
+	fs.StringVar(&configPubKey, "config-pubkey", "", "minisign public key (file or base64) for --require-signed-config")
+	fs.Var(&extraPacks, "pack", "add optional built-in check packs, e.g. cis (comma-separated or repeated)")
+	fs.StringVar(&configDir, "config-dir", "", "directory of config files merged in lexical order, later files overriding checks by name")
+	fs.StringVar(&envFile, "env-file", "", "KEY=VALUE file with extra variables for ${VAR} expansion in check commands")
+	fs.Var(defines, "D", "set a config variable as key=value, overriding the config (repeatable)")
+	fs.Var(&profiles, "profile", "only run checks in these profiles (comma-separated or repeated)")
+	fs.Var(&tags, "tags", "only run checks carrying one of these tags")
+	fs.Var(&skipTags, "skip-tags", "skip checks carrying any of these tags")
+	fs.Var(&onlyChecks, "only", "only run checks whose name matches one of these glob patterns")
+	fs.Var(&excludeNames, "exclude", "skip checks whose name matches one of these glob patterns")
+	fs.DurationVar(&runTimeout, "timeout", 0, "cancel checks still running after this long (e.g. 2m) and report them as TimedOut; 0 means no limit")
+	fs.BoolVar(&useSudo, "sudo", false, "when not run as root, run privileged checks through sudo -n instead of skipping them")
+	fs.BoolVar(&useSandbox, "sandbox", false, "run check commands in a hardened systemd-run unit, except checks with sandbox: false")
+	fs.IntVar(&concurrency, "concurrency", runtime.NumCPU(), "maximum number of check commands running at once")
+	fs.BoolVar(&sequential, "sequential", false, "run the checks one at a time in config order, ignoring --concurrency and priorities")
+	fs.BoolVar(&progressEvents, "progress-events", false, "without the interactive view, write check started and finished events to stderr as JSON lines")
+	fs.BoolVar(&failFast, "fail-fast", false, "cancel the remaining checks as soon as a critical check fails")
+	fs.StringVar(&failOn, "fail-on", severityInfo, "lowest severity of a failed check that makes kumo exit with 1: info, warning or critical")
+}
 
-	content := parts[0]
-	timing := "(" + parts[1]
+// prepareChecks loads the configured check set and applies the selection
+// flags. It returns the checks to run and Skipped results for the ones
+// filtered out along the way.
+func prepareChecks() ([]Check, []CheckResult, error) {
+	if _, ok := severityRanks[failOn]; !ok {
+		return nil, nil, fmt.Errorf("Unknown --fail-on severity %q (use info, warning or critical)", failOn)
+	}
+	if sequential {
+		concurrency = 1
+	}
+	if concurrency < 1 {
+		return nil, nil, fmt.Errorf("--concurrency must be at least 1, got %d", concurrency)
+	}
+	if maxOutputSize < 1 {
+		return nil, nil, fmt.Errorf("--max-output-bytes must be at least 1, got %d", maxOutputSize)
+	}
+	if err := resolveConfig(); err != nil {
+		return nil, nil, fmt.Errorf("Error loading config: %w", err)
+	}
 
-	if strings.Contains(content, "\n") {
-		lines := strings.Split(content, "\n")
-		indentedLines := make([]string, len(lines))
-		indentedLines[0] = ""
-		for i := 1; i < len(lines); i++ {
-			indentedLines[i] = "        " + lines[i]
+	var vars map[string]string
+	if envFile != "" {
+		var err error
+		if vars, err = loadEnvFile(envFile); err != nil {
+			return nil, nil, fmt.Errorf("Error loading env file: %w", err)
 		}
-		return strings.Join(indentedLines, "\n") + " " + timing
 	}
 
-	return content + " " + timing
+	cfg, err := loadChecks(configPath, configDir, vars, defines)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading config: %w", err)
+	}
+	if err := applyTheme(themeName, cfg.Theme); err != nil {
+		return nil, nil, err
+	}
+	checks, err := selectProfiles(cfg.Checks, profiles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error selecting checks: %w", err)
+	}
+	checks, err = selectNames(checks, onlyChecks, excludeNames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error selecting checks: %w", err)
+	}
+	checks, skipped := selectTags(checks, tags, skipTags)
+	checks, unmet := selectWhen(checks, detectFacts())
+	checks, unprivileged := selectPrivileged(checks)
+	return checks, append(append(skipped, unmet...), unprivileged...), nil
 }
 
-func (m model) View() string {
-	if m.quitting {
-		return "Exiting...\n"
+// configureLogging applies --log-format and --log-file. A log file records
+// every check run at debug level; the terminal only gets info and above.
+func configureLogging() error {
+	switch logFormat {
+	case "text":
+	case "json":
+		log.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("Unknown log format %q (use text or json)", logFormat)
 	}
 
-	if len(m.results) == 0 {
-		return loadingStyle.Render(fmt.Sprintf("Performing system checks... %s\n", spinnerFrames[m.spinner]))
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+		if err != nil {
+			return fmt.Errorf("Error opening log file: %w", err)
+		}
+		log.Out = f
+		log.SetLevel(logrus.DebugLevel)
+		if logFormat == "text" {
+			log.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+		}
 	}
+	return nil
+}
 
-	var resultView strings.Builder
-	w := tabwriter.NewWriter(&resultView, 2, 4, 2, ' ', 0)
-
-	fmt.Fprintln(w, titleStyle.Render("System Check Results:"))
-	fmt.Fprintln(w)
-
-	for _, result := range m.results {
-		statusSymbol := successStyle.Render("✔")
-		messageStyle := successStyle
-		if result.Status == "Failed" {
-			statusSymbol = errorStyle.Render("✘")
-			messageStyle = errorStyle
+func main() {
+	log.Out = os.Stdout
+	log.SetLevel(logrus.InfoLevel)
+	log.AddHook(redactHook{})
+	log.ExitFunc = func(int) { os.Exit(exitError) }
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "report":
+			os.Exit(runReportCommand(os.Args[2:]))
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
 		}
+	}
 
-		formattedMsg := formatMessage(result.Message)
-		fmt.Fprintf(w, "%s\t%s\t%s\n",
-			statusSymbol,
-			result.Name+"\t",
-			messageStyle.Render(formattedMsg))
+	jsonOutput := flag.Bool("json", false, "shorthand for --output json")
+	summaryOutput := flag.Bool("summary", false, "shorthand for --output summary: counts, duration and failed check names")
+	flag.StringVar(&outputFormat, "output", "", "run without the TUI and write results to stdout as: "+strings.Join(outputFormats, ", "))
+	flag.StringVar(&templatePath, "template", "", "Go text/template file rendering the report for --output template")
+	registerRunFlags(flag.CommandLine)
+	flag.StringVar(&logFormat, "log-format", "text", "log format: text or json")
+	flag.StringVar(&logFile, "log-file", "", "append logs to this file instead of the terminal, including a debug entry for every check run")
+	flag.StringVar(&themeName, "theme", "", "TUI colors: dark, light or custom (the config's theme section); defaults to custom when the config has one, else dark")
+	flag.BoolVar(&noColor, "no-color", false, "plain ASCII output without colors (also set by NO_COLOR or a non-terminal stdout)")
+	flag.DurationVar(&watchInterval, "watch", 0, "rerun the checks at this interval, logging results and reloading the config when it changes")
+	flag.StringVar(&reportDir, "report-dir", "", "also save each run's report to this directory as kumo-<timestamp>.<ext>")
+	flag.StringVar(&reportFormat, "report-format", "json", "format of the reports saved to --report-dir: "+strings.Join(outputFormats, ", "))
+	flag.IntVar(&reportKeep, "report-keep", 0, "keep only this many reports in --report-dir (0 keeps all)")
+	flag.DurationVar(&reportMaxAge, "report-max-age", 0, "delete reports in --report-dir older than this, e.g. 720h (0 keeps all)")
+	flag.StringVar(&signKeyPath, "sign-key", "", "minisign secret key for signing reports saved to --report-dir (password from "+signPasswordEnv+")")
+	flag.StringVar(&archivePath, "archive", "", "write a tar.gz with the report, raw check outputs, effective config and host facts")
+	flag.StringVar(&syslogTarget, "syslog", "", "send each result to syslog: local, udp://host:port or tcp://host:port")
+	flag.StringVar(&metricsFile, "metrics-file", "", "write Prometheus metrics for each run to this file (for the node_exporter textfile collector)")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "with --watch, serve Prometheus metrics of the latest run on this address, e.g. :9101")
+	flag.Parse()
+
+	if *jsonOutput {
+		outputFormat = "json"
+	}
+	if *summaryOutput {
+		outputFormat = "summary"
+	}
+	if outputFormat != "" {
+		if !slices.Contains(outputFormats, outputFormat) {
+			log.Fatalf("Unknown output format %q", outputFormat)
+		}
+		if outputFormat == "template" && templatePath == "" {
+			log.Fatal("--output template needs --template FILE")
+		}
+		// Keep stdout clean for the report
+		log.Out = os.Stderr
 	}
 
-	fmt.Fprintln(w)
-	fmt.Fprintln(w, footerStyle.Render("Press 'q' to quit"))
+	// Cron mails and CI logs get plain text instead of the TUI
+	interactive := isatty.IsTerminal(os.Stdout.Fd()) && os.Getenv("TERM") != "dumb"
+	if noColor || os.Getenv("NO_COLOR") != "" || !interactive {
+		plainOutput = true
+		lipgloss.SetColorProfile(termenv.Ascii)
+		log.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+	}
+	if err := configureLogging(); err != nil {
+		log.Fatal(err)
+	}
 
-	w.Flush()
+	if reportDir != "" {
+		if !slices.Contains(outputFormats, reportFormat) {
+			log.Fatalf("Unknown report format %q", reportFormat)
+		}
+		if reportFormat == "template" && templatePath == "" {
+			log.Fatal("--report-format template needs --template FILE")
+		}
+	}
+	if err := loadSigningKey(); err != nil {
+		log.Fatal(err)
+	}
 
-	if outputFormat == "json" {
-		jsonData, _ := json.MarshalIndent(m.results, "", "  ")
-		return string(jsonData)
+	if metricsAddr != "" && watchInterval == 0 {
+		log.Fatal("--metrics-addr requires --watch")
 	}
 
-	return resultView.String()
-}
+	if watchInterval > 0 {
+		if err := runWatch(watchInterval); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-func main() {
-	log.Out = os.Stdout
-	log.SetLevel(logrus.InfoLevel)
+	checks, skipped, err := prepareChecks()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if len(os.Args) > 1 && os.Args[1] == "--json" {
-		outputFormat = "json"
+	if outputFormat != "" {
+		report := runReport(checks, skipped, headlessProgress(checks))
+		if err := writeReport(os.Stdout, outputFormat, report); err != nil {
+			log.Fatalf("Error writing report: %v", err)
+		}
+		os.Exit(report.exitCode())
 	}
 
-	if os.Geteuid() != 0 {
-		log.Fatal("This program must be run as root.")
+	if !interactive {
+		report := runReport(checks, skipped, headlessProgress(checks))
+		fmt.Print(renderResults(report.Results, "", -1))
+		os.Exit(report.exitCode())
 	}
 
-	if _, err := tea.NewProgram(model{}).Run(); err != nil {
+	final, err := tea.NewProgram(newModel(checks, skipped), tea.WithMouseCellMotion()).Run()
+	if err != nil {
 		log.Fatalf("Error starting program: %v", err)
 	}
+	// Quitting twice before the run finished leaves no report
+	report := final.(model).report
+	if report == nil {
+		os.Exit(exitInterrupted)
+	}
+	os.Exit(report.exitCode())
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writeMetrics writes the report in the Prometheus text exposition format.
+// Skipped checks have no status or duration since they never ran.
+func writeMetrics(w io.Writer, report *Report) error {
+	var b strings.Builder
+	b.WriteString("# HELP kumo_check_status Whether the check passed (1) or not (0).\n")
+	b.WriteString("# TYPE kumo_check_status gauge\n")
+	for _, r := range report.Results {
+		if r.Status == statusSkipped || r.Status == statusCancelled {
+			continue
+		}
+		value := 0
+		if r.Status == statusPassed {
+			value = 1
+		}
+		fmt.Fprintf(&b, "kumo_check_status{%s} %d\n", metricLabels(r), value)
+	}
+
+	b.WriteString("# HELP kumo_check_duration_seconds Wall time of the check, including retries.\n")
+	b.WriteString("# TYPE kumo_check_duration_seconds gauge\n")
+	for _, r := range report.Results {
+		if r.Status != statusSkipped && r.Status != statusCancelled {
+			fmt.Fprintf(&b, "kumo_check_duration_seconds{%s} %s\n", metricLabels(r), formatNumber(r.Duration))
+		}
+	}
+
+	b.WriteString("# HELP kumo_checks Number of checks in the last run by status.\n")
+	b.WriteString("# TYPE kumo_checks gauge\n")
+	for _, status := range reportStatuses {
+		fmt.Fprintf(&b, "kumo_checks{status=\"%s\"} %d\n", status, countStatus(report.Results, status))
+	}
+
+	b.WriteString("# HELP kumo_last_run_timestamp_seconds When the last run started.\n")
+	b.WriteString("# TYPE kumo_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "kumo_last_run_timestamp_seconds %d\n", report.StartedAt.Unix())
+	b.WriteString("# HELP kumo_last_run_duration_seconds Wall time of the last run.\n")
+	b.WriteString("# TYPE kumo_last_run_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "kumo_last_run_duration_seconds %s\n", formatNumber(report.Duration))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func metricLabels(r CheckResult) string {
+	return fmt.Sprintf("name=\"%s\",severity=\"%s\"", escapeLabel(r.Name), escapeLabel(r.Severity))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// latestMetrics holds the metrics of the most recent run for /metrics.
+var latestMetrics = struct {
+	sync.Mutex
+	data []byte
+}{}
+
+// exportMetrics publishes a finished run to the --metrics-file and the
+// /metrics endpoint, whichever are enabled.
+func exportMetrics(report *Report) {
+	if metricsFile == "" && metricsAddr == "" {
+		return
+	}
+	var buf bytes.Buffer
+	writeMetrics(&buf, report)
+
+	latestMetrics.Lock()
+	latestMetrics.data = buf.Bytes()
+	latestMetrics.Unlock()
+
+	if metricsFile != "" {
+		// Written atomically so the node_exporter textfile collector never
+		// reads a half-written file
+		if err := writeFileAtomic(metricsFile, buf.Bytes(), 0o644); err != nil {
+			log.Errorf("Error writing metrics: %v", err)
+		}
+	}
+}
+
+// serveMetrics serves the metrics of the latest run on addr in the
+// background.
+func serveMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		latestMetrics.Lock()
+		data := latestMetrics.data
+		latestMetrics.Unlock()
+		if data == nil {
+			http.Error(w, "no run has finished yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(data)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+	log.Infof("Serving metrics on http://%s/metrics", ln.Addr())
+	return nil
+}
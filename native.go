@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CheckRunner runs a check and reports the outcome the way a command would:
+// a passing run has exit code 0 and a summary as its output. Native runners
+// also return the values they measured as structured data.
+type CheckRunner interface {
+	Run(ctx context.Context, check Check, env []string) commandResult
+}
+
+// shellRunner runs the check's cmd through bash.
+type shellRunner struct{}
+
+func (shellRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	c, err := shellCommand(ctx, check, env)
+	if err != nil {
+		return commandResult{exitCode: -1, err: err}
+	}
+	return runCommand(ctx, check.Name, c)
+}
+
+// Native implementations of common checks, chosen with "native: <name>"
+// instead of a cmd
+var nativeRunners = map[string]CheckRunner{
+	"accounts":         accountsRunner{},
+	"disk_usage":       diskUsageRunner{},
+	"dns":              dnsRunner{},
+	"docker":           dockerRunner{},
+	"file_permissions": filePermissionsRunner{},
+	"firewall":         firewallRunner{},
+	"kernel_version":   kernelVersionRunner{},
+	"listening_ports":  listeningPortsRunner{},
+	"mac":              macRunner{},
+	"mdraid":           mdraidRunner{},
+	"memory":           memoryRunner{},
+	"network":          networkRunner{},
+	"security_updates": securityUpdatesRunner{},
+	"smart":            smartRunner{},
+	"sshd_config":      sshdConfigRunner{},
+	"suid_files":       suidFilesRunner{},
+	"sudoers":          sudoersRunner{},
+	"sysctl":           sysctlRunner{},
+	"systemd_units":    systemdUnitsRunner{},
+	"tls_cert":         tlsCertRunner{},
+	"world_writable":   worldWritableRunner{},
+}
+
+// nativeNames lists the native runners for error messages.
+func nativeNames() string {
+	names := make([]string, 0, len(nativeRunners))
+	for name := range nativeRunners {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// runner returns what runs the check: its native runner or the shell.
+func (c Check) runner() CheckRunner {
+	if c.Native != "" {
+		return nativeRunners[c.Native]
+	}
+	return shellRunner{}
+}
+
+// command describes what the check runs, for the TUI.
+func (c Check) command() string {
+	if c.Native != "" {
+		return "native: " + c.Native
+	}
+	return c.Cmd
+}
+
+// nativeResult is the outcome of a native check: passed with summary as its
+// output, or failed with the problems found.
+func nativeResult(summary string, problems []string, data map[string]any) commandResult {
+	if len(problems) > 0 {
+		output := strings.Join(problems, "; ")
+		return commandResult{stdout: output, output: output, raw: output, exitCode: 1, data: data}
+	}
+	return commandResult{stdout: summary, output: summary, raw: summary, data: data}
+}
+
+// nativeError is the outcome of a native check that could not measure
+// anything.
+func nativeError(err error) commandResult {
+	return commandResult{exitCode: -1, err: err}
+}
+
+// percentArg parses the optional percentage limit in args[name]; 0 means
+// none.
+func percentArg(args map[string]string, name string) (float64, error) {
+	s, ok := args[name]
+	if !ok {
+		return 0, nil
+	}
+	limit, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || limit <= 0 || limit > 100 {
+		return 0, fmt.Errorf("%s: %q is not a percentage", name, s)
+	}
+	return limit, nil
+}
+
+// formatBytes renders n in binary units, e.g. "17.3 GiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// diskUsageRunner reports how full the filesystems holding args["paths"]
+// (comma-separated, "/" by default) are, failing when one is used above
+// args["max_used_percent"].
+type diskUsageRunner struct{}
+
+func (diskUsageRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	limit, err := percentArg(check.Args, "max_used_percent")
+	if err != nil {
+		return nativeError(err)
+	}
+	paths := listFlag{"/"}
+	if s := check.Args["paths"]; s != "" {
+		paths = nil
+		paths.Set(s)
+	}
+
+	var summary, problems []string
+	var filesystems []map[string]any
+	for _, path := range paths {
+		total, free, avail, err := statfs(path)
+		if err != nil {
+			return nativeError(err)
+		}
+		// Like df, relative to the space available to unprivileged users
+		used := total - free
+		var percent float64
+		if used+avail > 0 {
+			percent = float64(used) * 100 / float64(used+avail)
+		}
+		summary = append(summary, fmt.Sprintf("%s: %.0f%% used, %s free of %s", path, percent, formatBytes(avail), formatBytes(total)))
+		if limit > 0 && percent > limit {
+			problems = append(problems, fmt.Sprintf("%s is %.0f%% full (limit %g%%)", path, percent, limit))
+		}
+		filesystems = append(filesystems, map[string]any{
+			"path":            path,
+			"total_bytes":     total,
+			"used_bytes":      used,
+			"available_bytes": avail,
+			"used_percent":    percent,
+		})
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"filesystems": filesystems})
+}
+
+// memoryRunner reports memory and swap use from /proc/meminfo, failing when
+// memory is used above args["max_used_percent"].
+type memoryRunner struct{}
+
+func (memoryRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	limit, err := percentArg(check.Args, "max_used_percent")
+	if err != nil {
+		return nativeError(err)
+	}
+	info, err := readMeminfo("/proc/meminfo")
+	if err != nil {
+		return nativeError(err)
+	}
+	total, avail := info["MemTotal"], info["MemAvailable"]
+	if total == 0 {
+		return nativeError(fmt.Errorf("/proc/meminfo has no MemTotal"))
+	}
+	used := total - avail
+	percent := float64(used) * 100 / float64(total)
+	swapTotal, swapFree := info["SwapTotal"], info["SwapFree"]
+
+	summary := fmt.Sprintf("Memory: %s of %s used (%.0f%%), swap: %s of %s used",
+		formatBytes(used), formatBytes(total), percent, formatBytes(swapTotal-swapFree), formatBytes(swapTotal))
+	var problems []string
+	if limit > 0 && percent > limit {
+		problems = append(problems, fmt.Sprintf("memory is %.0f%% used (limit %g%%)", percent, limit))
+	}
+	return nativeResult(summary, problems, map[string]any{
+		"total_bytes":      total,
+		"available_bytes":  avail,
+		"used_percent":     percent,
+		"swap_total_bytes": swapTotal,
+		"swap_free_bytes":  swapFree,
+	})
+}
+
+// readMeminfo parses a /proc/meminfo style file into sizes in bytes.
+func readMeminfo(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g. "MemTotal:        8029436 kB"
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		info[key] = n
+	}
+	return info, scanner.Err()
+}
+
+// kernelVersionRunner reports the running kernel's release.
+type kernelVersionRunner struct{}
+
+func (kernelVersionRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	release, err := kernelRelease()
+	if err != nil {
+		return nativeError(err)
+	}
+	return nativeResult(release, nil, map[string]any{"release": release})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// accountsRunner audits the local accounts in /etc/passwd and /etc/shadow:
+// accounts with an empty password, accounts other than root with UID 0,
+// system accounts (below UID_MIN of /etc/login.defs) with a login shell
+// other than those in args["allow_shells"], and, with args["stale_days"],
+// unlocked user accounts that have not logged in for that many days
+// according to /var/log/lastlog. Without that file, as on distros that
+// moved to lastlog2, the stale test is skipped.
+type accountsRunner struct{}
+
+// nonLoginShells are the shells of accounts that cannot log in
+// interactively; sync, shutdown and halt are the traditional exceptions.
+var nonLoginShells = []string{"nologin", "false", "true", "sync", "shutdown", "halt"}
+
+// passwdEntry is an account from /etc/passwd joined with its password
+// fields from /etc/shadow.
+type passwdEntry struct {
+	name  string
+	uid   int
+	shell string
+	// From /etc/shadow; hasShadow is false without an entry there
+	password   string
+	lastChange int
+	hasShadow  bool
+}
+
+func (accountsRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	staleDays := 0
+	if s, ok := check.Args["stale_days"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nativeError(fmt.Errorf("stale_days: %q is not a number of days", s))
+		}
+		staleDays = n
+	}
+	var allowShells listFlag
+	allowShells.Set(check.Args["allow_shells"])
+
+	accounts, err := readAccounts("/etc/passwd", "/etc/shadow")
+	if err != nil {
+		return nativeError(err)
+	}
+	uidMin := loginDefsInt("/etc/login.defs", "UID_MIN", 1000)
+	var lastlog lastlogFile
+	var notes []string
+	if staleDays > 0 {
+		switch lastlog, err = openLastlog("/var/log/lastlog"); {
+		case os.IsNotExist(err):
+			staleDays = 0
+			notes = append(notes, "stale accounts not checked: /var/log/lastlog does not exist")
+		case err != nil:
+			return nativeError(err)
+		default:
+			defer lastlog.Close()
+		}
+	}
+
+	var problems []string
+	var users []string
+	empty, uidZero, systemShells, stale := []string{}, []string{}, []string{}, []string{}
+	for _, a := range accounts {
+		locked := strings.HasPrefix(a.password, "!") || strings.HasPrefix(a.password, "*")
+		if a.hasShadow && a.password == "" {
+			empty = append(empty, a.name)
+			problems = append(problems, a.name+" has an empty password")
+		}
+		if a.uid == 0 && a.name != "root" {
+			uidZero = append(uidZero, a.name)
+			problems = append(problems, a.name+" has UID 0")
+		}
+		loginShell := !slices.Contains(nonLoginShells, baseName(a.shell)) && a.shell != ""
+		if a.uid != 0 && a.uid < uidMin && loginShell && !slices.Contains(allowShells, a.name) {
+			systemShells = append(systemShells, a.name)
+			problems = append(problems, fmt.Sprintf("system account %s has the login shell %s", a.name, a.shell))
+		}
+		if a.uid < uidMin || !loginShell {
+			continue
+		}
+		users = append(users, a.name)
+		if staleDays == 0 || locked {
+			continue
+		}
+		// Accounts that never logged in count from their last password
+		// change, which is usually when they were created
+		since, err := lastlog.lastLogin(a.uid)
+		if err != nil {
+			return nativeError(err)
+		}
+		what := "last logged in"
+		if since.IsZero() {
+			if a.lastChange == 0 {
+				stale = append(stale, a.name)
+				problems = append(problems, a.name+" has never logged in")
+				continue
+			}
+			since, what = time.Unix(int64(a.lastChange)*86400, 0), "has never logged in, its password was set"
+		}
+		if days := int(time.Since(since).Hours() / 24); days > staleDays {
+			stale = append(stale, a.name)
+			problems = append(problems, fmt.Sprintf("%s %s %d days ago (limit %d)", a.name, what, days, staleDays))
+		}
+	}
+
+	summary := fmt.Sprintf("%d accounts, %d user accounts: %s", len(accounts), len(users), strings.Join(users, ", "))
+	summary = strings.Join(append([]string{summary}, notes...), "\n")
+	return nativeResult(summary, problems, map[string]any{
+		"users":                      users,
+		"empty_passwords":            empty,
+		"uid_zero":                   uidZero,
+		"system_accounts_with_shell": systemShells,
+		"stale":                      stale,
+	})
+}
+
+// baseName returns the last element of a slash-separated path.
+func baseName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// readAccounts parses the passwd file and joins in the password and last
+// change fields of the shadow file.
+func readAccounts(passwdPath, shadowPath string) ([]passwdEntry, error) {
+	passwd, err := readColonFile(passwdPath)
+	if err != nil {
+		return nil, err
+	}
+	shadow, err := readColonFile(shadowPath)
+	if err != nil {
+		return nil, err
+	}
+	shadowByName := make(map[string][]string)
+	for _, fields := range shadow {
+		shadowByName[fields[0]] = fields
+	}
+
+	var accounts []passwdEntry
+	for _, fields := range passwd {
+		// name:password:uid:gid:gecos:home:shell
+		if len(fields) < 7 {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		a := passwdEntry{name: fields[0], uid: uid, shell: fields[6]}
+		// name:password:lastchange:min:max:warn:inactive:expire:
+		if s, ok := shadowByName[a.name]; ok && len(s) > 2 {
+			a.password, a.hasShadow = s[1], true
+			a.lastChange, _ = strconv.Atoi(s[2])
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+// readColonFile splits the lines of a colon-separated file like
+// /etc/passwd into fields, skipping comments and NIS "+" entries.
+func readColonFile(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		lines = append(lines, strings.Split(line, ":"))
+	}
+	return lines, scanner.Err()
+}
+
+// loginDefsInt returns the numeric setting key of a login.defs file, or def
+// when it is not set.
+func loginDefsInt(path, key string, def int) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return def
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == key {
+			if n, err := strconv.Atoi(fields[1]); err == nil {
+				return n
+			}
+		}
+	}
+	return def
+}
+
+// lastlogFile reads last login times from a lastlog file: an array of
+// records indexed by UID, each a 32-bit time followed by the 32-byte line
+// and 256-byte host of that login. The file is sparse, so records are read
+// by offset.
+type lastlogFile struct{ f *os.File }
+
+func openLastlog(path string) (lastlogFile, error) {
+	f, err := os.Open(path)
+	return lastlogFile{f}, err
+}
+
+// lastLogin returns the last login time of uid, or the zero time for none.
+func (l lastlogFile) lastLogin(uid int) (time.Time, error) {
+	const recordSize = 4 + 32 + 256
+	if l.f == nil {
+		return time.Time{}, nil
+	}
+	record := make([]byte, recordSize)
+	if _, err := l.f.ReadAt(record, int64(uid)*recordSize); err == io.EOF {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	if t := binary.NativeEndian.Uint32(record); t != 0 {
+		return time.Unix(int64(t), 0), nil
+	}
+	return time.Time{}, nil
+}
+
+func (l lastlogFile) Close() {
+	if l.f != nil {
+		l.f.Close()
+	}
+}
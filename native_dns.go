@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dnsRunner resolves the hostnames in args["hosts"] (comma-separated)
+// against each resolver in args["resolvers"] (comma-separated, with an
+// optional port; the nameservers of /etc/resolv.conf by default) and
+// reports the answers and latency per resolver. It fails when a lookup
+// returns NXDOMAIN, times out after args["timeout"] (2s by default) or
+// otherwise fails, or takes longer than args["max_latency"].
+type dnsRunner struct{}
+
+// dnsLookup is the outcome of resolving one host against one resolver.
+type dnsLookup struct {
+	resolver, host string
+	addresses      []string
+	latency        time.Duration
+	err            error
+}
+
+func (dnsRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	var hosts listFlag
+	hosts.Set(check.Args["hosts"])
+	if len(hosts) == 0 {
+		return nativeError(fmt.Errorf("hosts: no hostnames given"))
+	}
+	timeout, maxLatency := 2*time.Second, time.Duration(0)
+	for name, d := range map[string]*time.Duration{"timeout": &timeout, "max_latency": &maxLatency} {
+		if s, ok := check.Args[name]; ok {
+			v, err := time.ParseDuration(s)
+			if err != nil || v <= 0 {
+				return nativeError(fmt.Errorf("%s: %q is not a duration", name, s))
+			}
+			*d = v
+		}
+	}
+	var resolvers listFlag
+	resolvers.Set(check.Args["resolvers"])
+	if len(resolvers) == 0 {
+		var err error
+		if resolvers, err = resolvConfNameservers("/etc/resolv.conf"); err != nil {
+			return nativeError(err)
+		}
+		if len(resolvers) == 0 {
+			return nativeError(fmt.Errorf("no nameservers in /etc/resolv.conf, set resolvers"))
+		}
+	}
+	for i, r := range resolvers {
+		if _, _, err := net.SplitHostPort(r); err != nil {
+			resolvers[i] = net.JoinHostPort(r, "53")
+		}
+	}
+
+	lookups := make([]dnsLookup, len(resolvers)*len(hosts))
+	var wg sync.WaitGroup
+	for i, server := range resolvers {
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+		for j, host := range hosts {
+			l := &lookups[i*len(hosts)+j]
+			l.resolver, l.host = server, host
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				start := time.Now()
+				l.addresses, l.err = resolver.LookupHost(lookupCtx, host)
+				l.latency = time.Since(start)
+			}()
+		}
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nativeError(err)
+	}
+
+	var summary, problems []string
+	var data []map[string]any
+	for i, server := range resolvers {
+		results := []map[string]any{}
+		resolved := 0
+		var slowest time.Duration
+		for _, l := range lookups[i*len(hosts) : (i+1)*len(hosts)] {
+			result := map[string]any{"host": l.host, "latency_ms": l.latency.Milliseconds()}
+			results = append(results, result)
+			if l.err != nil {
+				result["error"] = dnsErrorText(l.err)
+				problems = append(problems, fmt.Sprintf("%s via %s: %s", l.host, server, dnsErrorText(l.err)))
+				continue
+			}
+			resolved++
+			slowest = max(slowest, l.latency)
+			result["addresses"] = l.addresses
+			if maxLatency > 0 && l.latency > maxLatency {
+				problems = append(problems, fmt.Sprintf("%s via %s took %s (limit %s)", l.host, server, l.latency.Round(time.Millisecond), maxLatency))
+			}
+		}
+		data = append(data, map[string]any{"resolver": server, "lookups": results})
+		summary = append(summary, fmt.Sprintf("%s: %d of %d resolved, slowest %s", server, resolved, len(hosts), slowest.Round(time.Millisecond)))
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"resolvers": data})
+}
+
+// dnsErrorText describes a failed lookup: NXDOMAIN, a timeout or the
+// resolver's error.
+func dnsErrorText(err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return "NXDOMAIN"
+	case errors.As(err, &dnsErr) && dnsErr.IsTimeout, errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	case dnsErr != nil:
+		return dnsErr.Err
+	}
+	return err.Error()
+}
+
+// resolvConfNameservers returns the nameserver addresses of a resolv.conf
+// file, in order and without duplicates.
+func resolvConfNameservers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" && !slices.Contains(servers, fields[1]) {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers, scanner.Err()
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// dockerRunner audits the Docker daemon through its API on the unix socket
+// args["socket"] (/var/run/docker.sock by default); args["audit"] chooses
+// what is checked:
+//
+//	socket         the socket is owned by root and not accessible by others
+//	userns         the daemon runs with userns-remap or rootless
+//	privileged     no running container is privileged
+//	root           no running container runs as root
+//	healthcheck    every running container's image defines a healthcheck
+//	daemon_config  the hardening settings of args["daemon_json"]
+//	               (/etc/docker/daemon.json by default)
+type dockerRunner struct{}
+
+// dockerAudits are the values of args["audit"] of the docker check.
+var dockerAudits = map[string]func(ctx context.Context, d dockerClient, args map[string]string) ([]string, []string, map[string]any, error){
+	"socket":        dockerSocketAudit,
+	"userns":        dockerUsernsAudit,
+	"privileged":    dockerPrivilegedAudit,
+	"root":          dockerRootAudit,
+	"healthcheck":   dockerHealthcheckAudit,
+	"daemon_config": dockerDaemonConfigAudit,
+}
+
+func (dockerRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	audit, ok := dockerAudits[check.Args["audit"]]
+	if !ok {
+		names := make([]string, 0, len(dockerAudits))
+		for name := range dockerAudits {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return nativeError(fmt.Errorf("audit: unknown audit %q (use %s)", check.Args["audit"], strings.Join(names, ", ")))
+	}
+	socket := check.Args["socket"]
+	if socket == "" {
+		socket = "/var/run/docker.sock"
+	}
+	summary, problems, data, err := audit(ctx, newDockerClient(socket), check.Args)
+	if err != nil {
+		return nativeError(err)
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, data)
+}
+
+// dockerClient talks to the Docker Engine API on a unix socket.
+type dockerClient struct {
+	socket string
+	client *http.Client
+}
+
+func newDockerClient(socket string) dockerClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return dockerClient{socket: socket, client: &http.Client{Transport: transport}}
+}
+
+// get decodes the JSON response of the API endpoint path into v.
+func (d dockerClient) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker API: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct{ Message string }
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("docker API %s: %s %s", path, resp.Status, apiErr.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// dockerContainer is the part of a container's inspect output the audits
+// use.
+type dockerContainer struct {
+	Name   string
+	Config struct {
+		User        string
+		Image       string
+		Healthcheck *struct{ Test []string }
+	}
+	HostConfig struct {
+		Privileged bool
+	}
+}
+
+// runningContainers inspects every running container.
+func (d dockerClient) runningContainers(ctx context.Context) ([]dockerContainer, error) {
+	var list []struct{ ID string }
+	if err := d.get(ctx, "/containers/json", &list); err != nil {
+		return nil, err
+	}
+	containers := make([]dockerContainer, 0, len(list))
+	for _, c := range list {
+		var container dockerContainer
+		if err := d.get(ctx, "/containers/"+url.PathEscape(c.ID)+"/json", &container); err != nil {
+			return nil, err
+		}
+		container.Name = strings.TrimPrefix(container.Name, "/")
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// containerAudit reports the running containers for which failing returns
+// a problem.
+func containerAudit(ctx context.Context, d dockerClient, failing func(dockerContainer) string) ([]string, []string, map[string]any, error) {
+	containers, err := d.runningContainers(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var problems, names []string
+	for _, c := range containers {
+		if problem := failing(c); problem != "" {
+			problems = append(problems, problem)
+			names = append(names, c.Name)
+		}
+	}
+	summary := []string{fmt.Sprintf("%d running containers checked", len(containers))}
+	return summary, problems, map[string]any{"containers": len(containers), "failing": names}, nil
+}
+
+func dockerPrivilegedAudit(ctx context.Context, d dockerClient, args map[string]string) ([]string, []string, map[string]any, error) {
+	return containerAudit(ctx, d, func(c dockerContainer) string {
+		if c.HostConfig.Privileged {
+			return c.Name + " runs privileged"
+		}
+		return ""
+	})
+}
+
+func dockerRootAudit(ctx context.Context, d dockerClient, args map[string]string) ([]string, []string, map[string]any, error) {
+	return containerAudit(ctx, d, func(c dockerContainer) string {
+		// "user", "user:group", "uid" or "uid:gid"; empty is the image's
+		// default, root
+		user, _, _ := strings.Cut(c.Config.User, ":")
+		if user == "" || user == "root" || user == "0" {
+			return c.Name + " runs as root"
+		}
+		return ""
+	})
+}
+
+func dockerHealthcheckAudit(ctx context.Context, d dockerClient, args map[string]string) ([]string, []string, map[string]any, error) {
+	return containerAudit(ctx, d, func(c dockerContainer) string {
+		// The container's config includes the healthcheck of its image
+		if hc := c.Config.Healthcheck; hc == nil || len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+			return fmt.Sprintf("%s (%s) has no healthcheck", c.Name, c.Config.Image)
+		}
+		return ""
+	})
+}
+
+func dockerUsernsAudit(ctx context.Context, d dockerClient, args map[string]string) ([]string, []string, map[string]any, error) {
+	var info struct{ SecurityOptions []string }
+	if err := d.get(ctx, "/info", &info); err != nil {
+		return nil, nil, nil, err
+	}
+	// e.g. ["name=seccomp,profile=builtin", "name=userns"]
+	data := map[string]any{"security_options": info.SecurityOptions}
+	for _, option := range info.SecurityOptions {
+		if name, _, _ := strings.Cut(option, ","); name == "name=userns" || name == "name=rootless" {
+			return []string{strings.TrimPrefix(name, "name=") + " is enabled"}, nil, data, nil
+		}
+	}
+	return nil, []string{"the daemon runs without userns-remap, so root in a container is root on the host"}, data, nil
+}
+
+func dockerSocketAudit(ctx context.Context, d dockerClient, args map[string]string) ([]string, []string, map[string]any, error) {
+	fi, err := os.Stat(d.socket)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	uid, gid, ok := fileOwner(fi)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%s: no owner information", d.socket)
+	}
+	mode := fi.Mode().Perm()
+	summary := fmt.Sprintf("%s: mode %04o, owner %d, group %d", d.socket, mode, uid, gid)
+	var problems []string
+	if uid != 0 {
+		problems = append(problems, fmt.Sprintf("%s is owned by UID %d, not root", d.socket, uid))
+	}
+	if mode&0o007 != 0 {
+		problems = append(problems, fmt.Sprintf("%s is accessible by every user (mode %04o)", d.socket, mode))
+	}
+	return []string{summary}, problems, map[string]any{"mode": fmt.Sprintf("%04o", mode), "uid": uid, "gid": gid}, nil
+}
+
+// dockerDaemonSettings are the daemon.json settings daemon_config expects,
+// as in the CIS Docker Benchmark.
+var dockerDaemonSettings = []struct {
+	key  string
+	want bool
+}{
+	{"icc", false},
+	{"live-restore", true},
+	{"no-new-privileges", true},
+	{"userland-proxy", false},
+}
+
+func dockerDaemonConfigAudit(ctx context.Context, d dockerClient, args map[string]string) ([]string, []string, map[string]any, error) {
+	path := args["daemon_json"]
+	if path == "" {
+		path = "/etc/docker/daemon.json"
+	}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, []string{path + " does not exist, so the daemon runs with its defaults"}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var config map[string]any
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var summary, problems []string
+	for _, s := range dockerDaemonSettings {
+		got, ok := config[s.key].(bool)
+		if ok && got == s.want {
+			summary = append(summary, fmt.Sprintf("%s: %t", s.key, got))
+		} else {
+			problems = append(problems, fmt.Sprintf("%s is not %t", s.key, s.want))
+		}
+	}
+	if _, ok := config["log-driver"]; !ok {
+		problems = append(problems, "log-driver is not set")
+	}
+	hosts, _ := config["hosts"].([]any)
+	for _, host := range hosts {
+		if s, _ := host.(string); strings.HasPrefix(s, "tcp://") && config["tlsverify"] != true {
+			problems = append(problems, fmt.Sprintf("the daemon listens on %s without tlsverify", s))
+		}
+	}
+	return summary, problems, map[string]any{"config": config}, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// filePermissionsBaseline is the baseline of the file_permissions check:
+// each path or glob and its policy, "owner:group mode". Owners and groups
+// may have alternatives separated by "|", and the mode is the most that is
+// allowed: 0640 also accepts 0600 and 0400.
+var filePermissionsBaseline = map[string]string{
+	"/etc/passwd":              "root:root|wheel 0644",
+	"/etc/group":               "root:root|wheel 0644",
+	"/etc/shadow":              "root:root|shadow 0640",
+	"/etc/gshadow":             "root:root|shadow 0640",
+	"/etc/master.passwd":       "root:wheel 0600",
+	"/etc/sudoers":             "root:root|wheel 0440",
+	"/etc/sudoers.d":           "root:root|wheel 0755",
+	"/etc/ssh/sshd_config":     "root:root|wheel 0644",
+	"/etc/ssh/ssh_host_*_key":  "root:root|wheel|ssh_keys 0640",
+	"/etc/ssh/ssh_host_*.pub":  "root:root|wheel 0644",
+	"/etc/crontab":             "root:root|wheel 0644",
+	"/etc/cron.d":              "root:root|wheel 0755",
+	"/etc/cron.hourly":         "root:root 0755",
+	"/etc/cron.daily":          "root:root 0755",
+	"/etc/cron.weekly":         "root:root 0755",
+	"/etc/cron.monthly":        "root:root 0755",
+	"/var/spool/cron/crontabs": "root:crontab 01730",
+}
+
+// filePermissionsRunner checks the owner, group and mode of critical files
+// against filePermissionsBaseline. Every arg other than "baseline" names a
+// path or glob and its policy, adding to or overriding the baseline, and an
+// empty policy leaves the path out; baseline: "false" checks only the args.
+// Baseline paths that do not exist are skipped. Each deviating attribute is
+// reported on its own.
+type filePermissionsRunner struct{}
+
+// filePolicy is a parsed policy of the file_permissions check. Empty owners
+// or groups are not checked, and mode is -1 when it is not checked.
+type filePolicy struct {
+	owners, groups []string
+	mode           int64
+}
+
+func (filePermissionsRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	want := make(map[string]string)
+	explicit := make(map[string]bool)
+	switch check.Args["baseline"] {
+	case "", "true":
+		for path, policy := range filePermissionsBaseline {
+			want[path] = policy
+		}
+	case "false":
+	default:
+		return nativeError(fmt.Errorf("baseline: %q is not true or false", check.Args["baseline"]))
+	}
+	for path, policy := range check.Args {
+		if path == "baseline" {
+			continue
+		}
+		if policy == "" {
+			delete(want, path)
+			continue
+		}
+		want[path], explicit[path] = policy, true
+	}
+	if len(want) == 0 {
+		return nativeError(fmt.Errorf("no paths to check"))
+	}
+
+	patterns := make([]string, 0, len(want))
+	for pattern := range want {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+
+	var summary, problems []string
+	var files []map[string]any
+	names := ownerNames{users: make(map[uint32]string), groups: make(map[uint32]string)}
+	for _, pattern := range patterns {
+		policy, err := parseFilePolicy(want[pattern])
+		if err != nil {
+			return nativeError(fmt.Errorf("%s: %v", pattern, err))
+		}
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nativeError(fmt.Errorf("%s: %v", pattern, err))
+		}
+		if len(paths) == 0 {
+			if explicit[pattern] {
+				problems = append(problems, pattern+" does not exist")
+			}
+			continue
+		}
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+				continue
+			}
+			mode := unixMode(fi.Mode())
+			file := map[string]any{"path": path, "mode": fmt.Sprintf("%04o", mode)}
+			deviations := []string{}
+			uid, gid, ok := fileOwner(fi)
+			if ok {
+				owner, group := names.user(uid), names.group(gid)
+				file["owner"], file["group"] = owner, group
+				if len(policy.owners) > 0 && !slices.Contains(policy.owners, owner) && !slices.Contains(policy.owners, strconv.Itoa(int(uid))) {
+					deviations = append(deviations, fmt.Sprintf("owner is %s, want %s", owner, strings.Join(policy.owners, " or ")))
+				}
+				if len(policy.groups) > 0 && !slices.Contains(policy.groups, group) && !slices.Contains(policy.groups, strconv.Itoa(int(gid))) {
+					deviations = append(deviations, fmt.Sprintf("group is %s, want %s", group, strings.Join(policy.groups, " or ")))
+				}
+			} else if len(policy.owners) > 0 || len(policy.groups) > 0 {
+				deviations = append(deviations, "owner cannot be read on this system")
+			}
+			if policy.mode >= 0 {
+				if extra := int64(mode) &^ policy.mode; extra != 0 {
+					deviations = append(deviations, fmt.Sprintf("mode is %04o, want at most %04o (extra %04o)", mode, policy.mode, extra))
+				}
+			}
+			file["deviations"] = deviations
+			files = append(files, file)
+			for _, d := range deviations {
+				problems = append(problems, path+": "+d)
+			}
+			if len(deviations) == 0 && ok {
+				summary = append(summary, fmt.Sprintf("%s %s:%s %04o", path, file["owner"], file["group"], mode))
+			} else if len(deviations) == 0 {
+				summary = append(summary, fmt.Sprintf("%s %04o", path, mode))
+			}
+		}
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"files": files})
+}
+
+// parseFilePolicy parses a policy like "root:shadow|root 0640": an owner,
+// optionally followed by ":" and a group, and an octal mode, in any order
+// and each optional.
+func parseFilePolicy(s string) (filePolicy, error) {
+	policy := filePolicy{mode: -1}
+	for _, field := range strings.Fields(s) {
+		if mode, err := strconv.ParseInt(field, 8, 32); err == nil {
+			if mode > 07777 {
+				return policy, fmt.Errorf("mode %s is out of range", field)
+			}
+			policy.mode = mode
+			continue
+		}
+		owners, groups, _ := strings.Cut(field, ":")
+		if owners != "" {
+			policy.owners = strings.Split(owners, "|")
+		}
+		if groups != "" {
+			policy.groups = strings.Split(groups, "|")
+		}
+	}
+	return policy, nil
+}
+
+// unixMode returns the permission bits of m with the setuid, setgid and
+// sticky bits in their numeric places, e.g. 04755.
+func unixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return mode
+}
+
+// ownerNames looks up the names of UIDs and GIDs, falling back to the
+// number for those without a name.
+type ownerNames struct {
+	users, groups map[uint32]string
+}
+
+func (n ownerNames) user(uid uint32) string {
+	if name, ok := n.users[uid]; ok {
+		return name
+	}
+	name := strconv.Itoa(int(uid))
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	n.users[uid] = name
+	return name
+}
+
+func (n ownerNames) group(gid uint32) string {
+	if name, ok := n.groups[gid]; ok {
+		return name
+	}
+	name := strconv.Itoa(int(gid))
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	n.groups[gid] = name
+	return name
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// firewallRunner audits the host firewall of Linux by its effective rules,
+// whichever frontend wrote them: it reports ufw or firewalld when one is
+// active and reads the rules from nftables ("nft list ruleset") and from
+// iptables ("iptables-save", and "ip6tables-save" unless args["ipv6"] is
+// "false"); a backend that cannot be read is ignored when another one has
+// rules. It fails when incoming traffic is not dropped by default, for
+// IPv4 and, unless IPv6 is left out, IPv6, when an input chain accepts all
+// traffic, and when no input rule accepts a port in args["allow"]
+// (comma-separated, e.g. "22,tcp/443,udp/51820").
+type firewallRunner struct{}
+
+// firewallRules is what the firewall check gathers from a ruleset: the
+// families whose input is dropped unless a rule accepts it, the ports that
+// rules accept and the chains that accept everything.
+type firewallRules struct {
+	defaultDrop map[string]bool // "ipv4" and "ipv6"
+	accepted    []acceptedPorts
+	// Input chains that accept all traffic with a rule that matches
+	// nothing
+	open []string
+}
+
+// acceptedPorts is a range of ports a rule accepts; proto is empty when the
+// rule matches any transport protocol.
+type acceptedPorts struct {
+	proto  string
+	lo, hi int
+}
+
+func (r *firewallRules) accepts(proto string, port int) bool {
+	return slices.ContainsFunc(r.accepted, func(a acceptedPorts) bool {
+		return port >= a.lo && port <= a.hi && (a.proto == "" || proto == "" || a.proto == proto)
+	})
+}
+
+func (firewallRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	var allow listFlag
+	allow.Set(check.Args["allow"])
+	for _, entry := range allow {
+		if _, _, err := parsePortEntry(entry); err != nil {
+			return nativeError(fmt.Errorf("allow: %v", err))
+		}
+	}
+	families := []string{"ipv4", "ipv6"}
+	switch check.Args["ipv6"] {
+	case "", "true":
+	case "false":
+		families = families[:1]
+	default:
+		return nativeError(fmt.Errorf("ipv6: %q is not true or false", check.Args["ipv6"]))
+	}
+
+	rules := &firewallRules{defaultDrop: make(map[string]bool)}
+	// A backend that fails, like ip6tables-save on a host without IPv6,
+	// counts as having no rules, and only fails the check when no other
+	// backend has any
+	var backends []string
+	var failures []string
+	if _, err := exec.LookPath("nft"); err == nil {
+		found, err := nftRules(ctx, rules)
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else if found {
+			backends = append(backends, "nftables")
+		}
+	}
+	commands := map[string]string{"ipv4": "iptables-save", "ipv6": "ip6tables-save"}
+	for _, family := range families {
+		command := commands[family]
+		if _, err := exec.LookPath(command); err != nil {
+			continue
+		}
+		found, err := iptablesRules(ctx, command, rules)
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else if found && !slices.Contains(backends, "iptables") {
+			backends = append(backends, "iptables")
+		}
+	}
+	if len(backends) == 0 && len(failures) > 0 {
+		return nativeError(errors.New(strings.Join(failures, "; ")))
+	}
+	if len(backends) == 0 {
+		return nativeError(fmt.Errorf("no firewall rules found in nftables or iptables"))
+	}
+	frontend := firewallFrontend(ctx)
+
+	var problems []string
+	for _, family := range families {
+		if !rules.defaultDrop[family] {
+			problems = append(problems, fmt.Sprintf("incoming %s traffic is not dropped by default", strings.Replace(family, "ipv", "IPv", 1)))
+		}
+	}
+	for _, chain := range rules.open {
+		problems = append(problems, chain+" accepts all incoming traffic")
+	}
+	var missing []string
+	for _, entry := range allow {
+		proto, port, _ := parsePortEntry(entry)
+		if !rules.accepts(proto, port) {
+			missing = append(missing, entry)
+			problems = append(problems, fmt.Sprintf("no rule accepts %s", entry))
+		}
+	}
+
+	summary := fmt.Sprintf("%s with %s rules, incoming traffic dropped by default", frontend, strings.Join(backends, " and "))
+	if len(allow) > 0 {
+		summary += ", accepting " + strings.Join(allow, ", ")
+	}
+	return nativeResult(summary, problems, map[string]any{
+		"frontend":     frontend,
+		"backends":     backends,
+		"default_drop": rules.defaultDrop,
+		"open_chains":  rules.open,
+		"failures":     failures,
+		"missing":      missing,
+	})
+}
+
+// firewallFrontend names the active firewall frontend, "ufw" or
+// "firewalld", or "no frontend" when the rules were written otherwise.
+func firewallFrontend(ctx context.Context) string {
+	if out, err := exec.CommandContext(ctx, "ufw", "status").Output(); err == nil && strings.Contains(string(out), "Status: active") {
+		return "ufw"
+	}
+	if out, err := exec.CommandContext(ctx, "firewall-cmd", "--state").Output(); err == nil && strings.TrimSpace(string(out)) == "running" {
+		return "firewalld"
+	}
+	return "no frontend"
+}
+
+// nftFamilies are the address families whose input an nftables table of
+// each family filters.
+var nftFamilies = map[string][]string{"inet": {"ipv4", "ipv6"}, "ip": {"ipv4"}, "ip6": {"ipv6"}}
+
+// nftRule is the statements of an nftables rule, each an object keyed by
+// its kind, e.g. "match" or "accept".
+type nftRule []map[string]json.RawMessage
+
+// nftRules adds the rules of "nft --json list ruleset" to rules and
+// reports whether the ruleset filters input at all. Only the chains on the
+// input hook and those they jump or go to count. Input is dropped by
+// default when a chain on the input hook has a drop policy or ends with a
+// rule that drops or rejects everything, as firewalld's chains do.
+func nftRules(ctx context.Context, rules *firewallRules) (bool, error) {
+	out, err := firewallCommand(ctx, "nft", "--json", "list", "ruleset")
+	if err != nil {
+		return false, err
+	}
+	var ruleset struct {
+		Nftables []struct {
+			Chain *struct {
+				Family, Table, Name, Type, Hook, Policy string
+			}
+			Set *struct {
+				Family, Table, Name string
+				Elem                []json.RawMessage
+			}
+			Rule *struct {
+				Family, Table, Chain string
+				Expr                 nftRule
+			}
+		}
+	}
+	if err := json.Unmarshal(out, &ruleset); err != nil {
+		return false, fmt.Errorf("nft: %v", err)
+	}
+
+	// Named sets, for rules like "tcp dport @allowed accept"
+	sets := make(map[string][]json.RawMessage)
+	// Chains by "family table name", and those on the input hook
+	chains := make(map[string][]nftRule)
+	var base []string
+	for _, item := range ruleset.Nftables {
+		if s := item.Set; s != nil {
+			sets[s.Family+" "+s.Table+" "+s.Name] = s.Elem
+		}
+		if c := item.Chain; c != nil && c.Hook == "input" && c.Type == "filter" {
+			key := c.Family + " " + c.Table + " " + c.Name
+			base = append(base, key)
+			if c.Policy == "drop" {
+				for _, family := range nftFamilies[c.Family] {
+					rules.defaultDrop[family] = true
+				}
+			}
+		}
+		if r := item.Rule; r != nil && len(r.Expr) > 0 {
+			key := r.Family + " " + r.Table + " " + r.Chain
+			chains[key] = append(chains[key], r.Expr)
+		}
+	}
+
+	reached, always := reachableChains(base, func(key string) ([]string, []string) {
+		table := key[:strings.LastIndex(key, " ")+1]
+		var targets, unconditional []string
+		for _, r := range chains[key] {
+			for _, target := range nftJumpTargets(r) {
+				targets = append(targets, table+target)
+				if nftUnconditional(r, "jump", "goto") {
+					unconditional = append(unconditional, table+target)
+				}
+			}
+		}
+		return targets, unconditional
+	})
+	for _, key := range slices.Sorted(maps.Keys(reached)) {
+		table := key[:strings.LastIndex(key, " ")]
+		for _, r := range chains[key] {
+			if always[key] && nftUnconditional(r, "accept") {
+				rules.open = append(rules.open, "nftables chain "+key)
+			}
+			if _, ok := r[len(r)-1]["accept"]; ok {
+				rules.accepted = append(rules.accepted, nftAcceptedPorts(r, sets, table)...)
+			}
+		}
+	}
+	for _, key := range base {
+		if r := chains[key]; len(r) > 0 && nftUnconditional(r[len(r)-1], "drop", "reject") {
+			for _, family := range nftFamilies[strings.Fields(key)[0]] {
+				rules.defaultDrop[family] = true
+			}
+		}
+	}
+	return len(base) > 0, nil
+}
+
+// nftAcceptedPorts returns the destination ports that the dport matches of
+// an accepting rule of table accept.
+func nftAcceptedPorts(r nftRule, sets map[string][]json.RawMessage, table string) []acceptedPorts {
+	var accepted []acceptedPorts
+	for _, expr := range r {
+		var match struct {
+			Left struct {
+				Payload struct{ Protocol, Field string }
+			}
+			Right json.RawMessage
+			Op    string
+		}
+		if raw, ok := expr["match"]; !ok || json.Unmarshal(raw, &match) != nil {
+			continue
+		}
+		if match.Left.Payload.Field != "dport" || (match.Op != "==" && match.Op != "in") {
+			continue
+		}
+		proto := match.Left.Payload.Protocol
+		if proto == "th" {
+			proto = ""
+		}
+		for _, ports := range nftPorts(match.Right, sets, table) {
+			ports.proto = proto
+			accepted = append(accepted, ports)
+		}
+	}
+	return accepted
+}
+
+// nftJumpTargets returns the chains an nftables rule jumps or goes to,
+// including those of verdict maps like firewalld's "iifname vmap { ... }".
+func nftJumpTargets(r nftRule) []string {
+	var targets []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for key, value := range v {
+				if verdict, ok := value.(map[string]any); ok && (key == "jump" || key == "goto") {
+					if target, ok := verdict["target"].(string); ok {
+						targets = append(targets, target)
+						continue
+					}
+				}
+				walk(value)
+			}
+		case []any:
+			for _, value := range v {
+				walk(value)
+			}
+		}
+	}
+	for _, expr := range r {
+		for key, raw := range expr {
+			var v any
+			if json.Unmarshal(raw, &v) == nil {
+				walk(map[string]any{key: v})
+			}
+		}
+	}
+	return targets
+}
+
+// nftPorts returns the ports of the right-hand side of an nftables match:
+// a port, a range, an anonymous set of both or a named set of the table.
+func nftPorts(raw json.RawMessage, sets map[string][]json.RawMessage, table string) []acceptedPorts {
+	var port int
+	if json.Unmarshal(raw, &port) == nil {
+		return []acceptedPorts{{lo: port, hi: port}}
+	}
+	var name string
+	if json.Unmarshal(raw, &name) == nil && strings.HasPrefix(name, "@") {
+		var ports []acceptedPorts
+		for _, elem := range sets[table+" "+strings.TrimPrefix(name, "@")] {
+			ports = append(ports, nftPorts(elem, sets, table)...)
+		}
+		return ports
+	}
+	var value struct {
+		Range []int
+		Set   []json.RawMessage
+	}
+	if json.Unmarshal(raw, &value) != nil {
+		return nil
+	}
+	if len(value.Range) == 2 {
+		return []acceptedPorts{{lo: value.Range[0], hi: value.Range[1]}}
+	}
+	var ports []acceptedPorts
+	for _, elem := range value.Set {
+		ports = append(ports, nftPorts(elem, sets, table)...)
+	}
+	return ports
+}
+
+// nftUnconditional reports whether an nftables rule applies one of the
+// verdicts to every packet: it has one and matches nothing.
+func nftUnconditional(r nftRule, verdicts ...string) bool {
+	verdict := false
+	for _, e := range r {
+		for key := range e {
+			switch {
+			case slices.Contains(verdicts, key):
+				verdict = true
+			case key == "counter" || key == "log":
+			default:
+				return false
+			}
+		}
+	}
+	return verdict
+}
+
+// reachableChains returns the chains reachable from the base chains, given
+// the targets each chain jumps to and those it jumps to unconditionally,
+// and the subset reachable by unconditional jumps alone, whose rules apply
+// to all traffic of the base chains.
+func reachableChains(base []string, jumps func(chain string) (targets, unconditional []string)) (reached, always map[string]bool) {
+	reached, always = make(map[string]bool), make(map[string]bool)
+	var visit func(chain string, unconditional bool)
+	visit = func(chain string, unconditional bool) {
+		if reached[chain] && (always[chain] || !unconditional) {
+			return
+		}
+		reached[chain] = true
+		always[chain] = always[chain] || unconditional
+		targets, alwaysTargets := jumps(chain)
+		for _, target := range targets {
+			visit(target, unconditional && slices.Contains(alwaysTargets, target))
+		}
+	}
+	for _, chain := range base {
+		visit(chain, true)
+	}
+	return reached, always
+}
+
+// iptablesCommentRE matches the comments of iptables-save rules, which may
+// be quoted and contain spaces.
+var iptablesCommentRE = regexp.MustCompile(`-m comment --comment ("(\\.|[^"])*"|\S+)`)
+
+// iptablesRules adds the filter table of iptables-save or ip6tables-save
+// to rules and reports whether it has one. Only INPUT and the chains it
+// jumps or goes to count. Input is dropped by default when the INPUT
+// chain's policy is DROP or its last rule drops or rejects everything.
+func iptablesRules(ctx context.Context, command string, rules *firewallRules) (bool, error) {
+	out, err := firewallCommand(ctx, command, "-t", "filter")
+	if err != nil {
+		return false, err
+	}
+	family := "ipv4"
+	if command == "ip6tables-save" {
+		family = "ipv6"
+	}
+
+	found := false
+	chains := make(map[string][][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(iptablesCommentRE.ReplaceAllString(scanner.Text(), ""))
+		switch {
+		case len(fields) >= 2 && fields[0] == ":INPUT":
+			found = true
+			if fields[1] == "DROP" {
+				rules.defaultDrop[family] = true
+			}
+		case len(fields) >= 2 && fields[0] == "-A":
+			chains[fields[1]] = append(chains[fields[1]], fields[2:])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+
+	reached, always := reachableChains([]string{"INPUT"}, func(chain string) ([]string, []string) {
+		var targets, unconditional []string
+		for _, r := range chains[chain] {
+			if target := iptablesTarget(r); chains[target] != nil {
+				targets = append(targets, target)
+				if iptablesUnconditional(r) {
+					unconditional = append(unconditional, target)
+				}
+			}
+		}
+		return targets, unconditional
+	})
+	for _, chain := range slices.Sorted(maps.Keys(reached)) {
+		for _, r := range chains[chain] {
+			if iptablesTarget(r) != "ACCEPT" {
+				continue
+			}
+			if always[chain] && iptablesUnconditional(r) {
+				rules.open = append(rules.open, strings.TrimSuffix(command, "-save")+" chain "+chain)
+			}
+			rules.accepted = append(rules.accepted, iptablesPorts(r)...)
+		}
+	}
+	// e.g. "-A INPUT -j REJECT --reject-with icmp-host-prohibited"
+	if input := chains["INPUT"]; len(input) > 0 {
+		last := input[len(input)-1]
+		if target := iptablesTarget(last); (target == "DROP" || target == "REJECT") && iptablesUnconditional(last) {
+			rules.defaultDrop[family] = true
+		}
+	}
+	return found, nil
+}
+
+// iptablesUnconditional reports whether an iptables rule, without the
+// chain, matches every packet: nothing precedes its -j or -g target.
+func iptablesUnconditional(fields []string) bool {
+	return len(fields) > 0 && (fields[0] == "-j" || fields[0] == "-g")
+}
+
+// iptablesTarget returns the target of an iptables rule, the argument of -j
+// or -g.
+func iptablesTarget(fields []string) string {
+	for i, f := range fields {
+		if (f == "-j" || f == "-g") && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// iptablesPorts returns the destination ports an iptables rule matches, from
+// --dport or multiport's --dports, e.g. "22" or "80,443,8000:8080".
+func iptablesPorts(fields []string) []acceptedPorts {
+	proto := ""
+	var ports []acceptedPorts
+	for i := 0; i+1 < len(fields); i++ {
+		negated := i > 0 && fields[i-1] == "!"
+		switch fields[i] {
+		case "-p":
+			if !negated {
+				proto = fields[i+1]
+			}
+		case "--dport", "--dports", "--destination-port", "--destination-ports":
+			if negated {
+				return nil
+			}
+			for _, s := range strings.Split(fields[i+1], ",") {
+				lo, hi, isRange := strings.Cut(s, ":")
+				if !isRange {
+					hi = lo
+				}
+				l, err1 := strconv.Atoi(lo)
+				h, err2 := strconv.Atoi(hi)
+				if err1 == nil && err2 == nil {
+					ports = append(ports, acceptedPorts{lo: l, hi: h})
+				}
+			}
+		}
+	}
+	for i := range ports {
+		ports[i].proto = proto
+	}
+	return ports
+}
+
+// firewallCommand runs a command that reads firewall rules and returns its
+// output, with its error output as the error when it fails.
+func firewallCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, name, args...)
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", name, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// kernelRelease returns the running kernel's release, e.g. "6.8.0-45-generic".
+func kernelRelease() (string, error) {
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(release)), nil
+}
+
+// kernelOSVersion returns the OS version where there is no os-release file;
+// on Linux that is left empty.
+func kernelOSVersion() string {
+	return ""
+}
+
+// defaultRoutes reports whether the main routing tables of /proc/net have an
+// IPv4 and an IPv6 default route that is up and not a reject route.
+func defaultRoutes() (ipv4, ipv6 bool, err error) {
+	const routeUp, routeReject = 0x1, 0x200
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+	err = scanProcTable("/proc/net/route", func(fields []string) {
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		if len(fields) > 7 && fields[1] == "00000000" && fields[7] == "00000000" && flags&routeUp != 0 && flags&routeReject == 0 {
+			ipv4 = true
+		}
+	})
+	if err != nil {
+		return false, false, err
+	}
+	// Destination PrefixLen Source SourcePrefixLen NextHop Metric RefCnt Use Flags Iface
+	err = scanProcTable("/proc/net/ipv6_route", func(fields []string) {
+		if len(fields) < 10 {
+			return
+		}
+		flags, _ := strconv.ParseUint(fields[8], 16, 32)
+		if fields[0] == strings.Repeat("0", 32) && fields[1] == "00" && flags&routeUp != 0 && flags&routeReject == 0 {
+			ipv6 = true
+		}
+	})
+	if os.IsNotExist(err) {
+		// IPv6 is disabled
+		err = nil
+	}
+	return ipv4, ipv6, err
+}
+
+// dadFailedAddresses returns, by interface, the IPv6 addresses that failed
+// duplicate address detection because another host on the link has them.
+func dadFailedAddresses() (map[string][]string, error) {
+	const dadFailed = 0x08
+	failed := make(map[string][]string)
+	// Address Index PrefixLen Scope Flags Iface
+	err := scanProcTable("/proc/net/if_inet6", func(fields []string) {
+		if len(fields) < 6 || len(fields[0]) != 32 {
+			return
+		}
+		if flags, _ := strconv.ParseUint(fields[4], 16, 32); flags&dadFailed == 0 {
+			return
+		}
+		var ip net.IP
+		for i := 0; i < 32; i += 2 {
+			b, _ := strconv.ParseUint(fields[0][i:i+2], 16, 8)
+			ip = append(ip, byte(b))
+		}
+		failed[fields[5]] = append(failed[fields[5]], ip.String())
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return failed, err
+}
+
+// scanProcTable calls fn with the fields of each line of a /proc table
+// with at least 5 fields, skipping the header of those that have one.
+func scanProcTable(path string, fn func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] == "Iface" {
+			continue
+		}
+		fn(fields)
+	}
+	return scanner.Err()
+}
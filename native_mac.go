@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// macRunner detects the mandatory access control system of the host and
+// checks that it enforces a loaded policy: SELinux in enforcing mode, or
+// AppArmor with profiles loaded and none of them in complain mode unless
+// args["allow_complain"] is "true". The processes running unconfined are
+// counted, and fail the check above args["max_unconfined"].
+type macRunner struct{}
+
+func (macRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	allowComplain := check.Args["allow_complain"] == "true"
+	maxUnconfined := -1
+	if s, ok := check.Args["max_unconfined"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nativeError(fmt.Errorf("max_unconfined: %q is not a number", s))
+		}
+		maxUnconfined = n
+	}
+
+	var summary, problems []string
+	var data map[string]any
+	var unconfined int
+	// Only present when selinuxfs is mounted
+	enforce := strings.TrimSpace(readFileString("/sys/fs/selinux/enforce"))
+	switch {
+	case enforce != "":
+		mode := "permissive"
+		if enforce == "1" {
+			mode = "enforcing"
+		}
+		// The initial SIDs only have full contexts, e.g.
+		// "system_u:system_r:kernel_t:s0", once a policy is loaded;
+		// policyvers is just the newest version the kernel supports
+		kernelContext := strings.TrimRight(readFileString("/sys/fs/selinux/initial_contexts/kernel"), "\x00\n")
+		unconfined = countProcesses(func(label string) bool {
+			// e.g. "unconfined_u:unconfined_r:unconfined_t:s0-s0:c0.c1023"
+			parts := strings.Split(label, ":")
+			return len(parts) > 2 && strings.HasPrefix(parts[2], "unconfined")
+		})
+
+		summary = append(summary, "SELinux is "+mode)
+		if !strings.Contains(kernelContext, ":") {
+			problems = append(problems, "SELinux has no policy loaded")
+		} else {
+			summary[0] += ", kernel context " + kernelContext
+		}
+		if mode != "enforcing" {
+			problems = append(problems, "SELinux is in permissive mode")
+		}
+		data = map[string]any{"system": "selinux", "mode": mode, "kernel_context": kernelContext}
+
+	case strings.TrimSpace(readFileString("/sys/module/apparmor/parameters/enabled")) == "Y":
+		profiles, err := appArmorProfiles("/sys/kernel/security/apparmor/profiles")
+		if err != nil {
+			return nativeError(fmt.Errorf("AppArmor profiles: %v", err))
+		}
+		complainProcesses := countProcesses(func(label string) bool {
+			return strings.HasSuffix(label, " (complain)")
+		})
+		unconfined = countProcesses(func(label string) bool {
+			return label == "unconfined"
+		})
+
+		summary = append(summary, fmt.Sprintf("AppArmor: %d profiles in enforce mode, %d in complain mode", profiles["enforce"], profiles["complain"]))
+		if profiles["enforce"]+profiles["complain"]+profiles["kill"] == 0 {
+			problems = append(problems, "AppArmor has no profiles loaded")
+		}
+		if profiles["complain"] > 0 && !allowComplain {
+			problems = append(problems, fmt.Sprintf("%d AppArmor profiles are in complain mode (%d processes)", profiles["complain"], complainProcesses))
+		}
+		data = map[string]any{
+			"system":             "apparmor",
+			"profiles":           profiles,
+			"complain_processes": complainProcesses,
+		}
+
+	default:
+		return nativeResult("", []string{"no mandatory access control system (SELinux or AppArmor) is active"}, map[string]any{"system": "none"})
+	}
+
+	summary = append(summary, fmt.Sprintf("%d processes unconfined", unconfined))
+	if maxUnconfined >= 0 && unconfined > maxUnconfined {
+		problems = append(problems, fmt.Sprintf("%d processes are unconfined (limit %d)", unconfined, maxUnconfined))
+	}
+	data["unconfined_processes"] = unconfined
+	return nativeResult(strings.Join(summary, "\n"), problems, data)
+}
+
+// appArmorProfiles counts the loaded AppArmor profiles by mode from the
+// profiles file of securityfs, whose lines look like
+// "/usr/sbin/cupsd (enforce)".
+func appArmorProfiles(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counts := map[string]int{"enforce": 0, "complain": 0}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.LastIndex(line, " ("); i >= 0 && strings.HasSuffix(line, ")") {
+			counts[line[i+2:len(line)-1]]++
+		}
+	}
+	return counts, scanner.Err()
+}
+
+// countProcesses counts the user space processes whose security label
+// matches; kernel threads, which have no command line, are left out.
+func countProcesses(match func(label string) bool) int {
+	pids, _ := filepath.Glob("/proc/[0-9]*")
+	n := 0
+	for _, pid := range pids {
+		if cmdline, err := os.ReadFile(filepath.Join(pid, "cmdline")); err != nil || len(cmdline) == 0 {
+			continue
+		}
+		// Kernels with stacked LSMs keep the AppArmor label in its own file
+		label := readFileString(filepath.Join(pid, "attr/apparmor/current"))
+		if label == "" {
+			label = readFileString(filepath.Join(pid, "attr/current"))
+		}
+		if match(strings.TrimSpace(strings.TrimRight(label, "\x00"))) {
+			n++
+		}
+	}
+	return n
+}
+
+// readFileString returns the contents of the file at path, or "" when it
+// cannot be read.
+func readFileString(path string) string {
+	data, _ := os.ReadFile(path)
+	return string(data)
+}
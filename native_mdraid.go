@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mdraidRunner checks the Linux software RAID arrays in /proc/mdstat. It
+// fails on arrays that are inactive, degraded or have failed member
+// devices, on arrays in args["arrays"] (comma-separated, e.g. "md0,md1")
+// that do not exist, and on rebuilds that have been running for longer than
+// args["max_rebuild"], a duration like "12h". With mdadm installed and
+// kumo running as root, the state "mdadm --detail" reports is added too.
+type mdraidRunner struct{}
+
+// mdArray is an array from /proc/mdstat.
+type mdArray struct {
+	name, state, level string
+	// Member devices, and those marked failed (F) or spare (S)
+	devices, failed, spares []string
+	// Wanted and working devices from "[2/1]", 0 for levels without
+	// redundancy
+	want, working int
+	// The resync, recovery, reshape or check in progress, if any
+	sync     string
+	progress float64
+	done     int64
+	speed    int64 // KiB per second
+	finish   string
+}
+
+var (
+	mdDeviceRE = regexp.MustCompile(`^(\S+)\[\d+\](\([A-Z]\))?$`)
+	mdCountRE  = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	mdSyncRE   = regexp.MustCompile(`(resync|recovery|reshape|check)\s*=\s*([\d.]+)%\s*\((\d+)/\d+\)\s*finish=(\S+)\s*speed=(\d+)K/sec`)
+)
+
+func (mdraidRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	var maxRebuild time.Duration
+	if s, ok := check.Args["max_rebuild"]; ok {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nativeError(fmt.Errorf("max_rebuild: %q is not a duration", s))
+		}
+		maxRebuild = d
+	}
+	var wantArrays listFlag
+	wantArrays.Set(check.Args["arrays"])
+
+	arrays, err := readMdstat("/proc/mdstat")
+	if err != nil {
+		return nativeError(err)
+	}
+	_, lookErr := exec.LookPath("mdadm")
+	withDetail := lookErr == nil && isRoot()
+
+	var summary, problems []string
+	var data []map[string]any
+	for _, a := range arrays {
+		entry := map[string]any{
+			"name":    a.name,
+			"state":   a.state,
+			"level":   a.level,
+			"devices": a.devices,
+			"failed":  a.failed,
+			"spares":  a.spares,
+		}
+		if a.want > 0 {
+			entry["wanted_devices"], entry["working_devices"] = a.want, a.working
+		}
+		issues := []string{}
+		if !strings.HasPrefix(a.state, "active") {
+			issues = append(issues, "is "+a.state)
+		}
+		if a.working < a.want {
+			issues = append(issues, fmt.Sprintf("is degraded: %d of %d devices working", a.working, a.want))
+		}
+		if len(a.failed) > 0 {
+			issues = append(issues, "has failed devices: "+strings.Join(a.failed, ", "))
+		}
+		if a.sync != "" {
+			entry["sync"] = map[string]any{"action": a.sync, "percent": a.progress, "finish": a.finish}
+			// mdstat does not tell when a rebuild started: estimate its
+			// running time from the blocks done at the current speed
+			if a.sync != "check" && maxRebuild > 0 && a.speed > 0 {
+				elapsed := time.Duration(a.done/a.speed) * time.Second
+				entry["sync"].(map[string]any)["elapsed_seconds"] = int64(elapsed.Seconds())
+				if elapsed > maxRebuild {
+					issues = append(issues, fmt.Sprintf("%s at %.1f%% has been running for about %s (limit %s), finish in %s", a.sync, a.progress, elapsed.Round(time.Minute), maxRebuild, a.finish))
+				}
+			}
+		}
+		if withDetail {
+			// A problem of its own only when mdstat shows none
+			if state, err := mdadmState(ctx, a.name); err == nil {
+				entry["detail_state"] = state
+				if len(issues) == 0 && (strings.Contains(state, "degraded") || strings.Contains(state, "FAILED") || strings.Contains(state, "Not Started")) {
+					issues = append(issues, "is "+state+" according to mdadm")
+				}
+			}
+		}
+		entry["problems"] = issues
+		data = append(data, entry)
+		for _, issue := range issues {
+			problems = append(problems, a.name+" "+issue)
+		}
+		if len(issues) == 0 {
+			line := fmt.Sprintf("%s: %s %s, %s", a.name, a.state, a.level, strings.Join(a.devices, ", "))
+			if a.sync != "" {
+				line += fmt.Sprintf(", %s %.1f%%", a.sync, a.progress)
+			}
+			summary = append(summary, line)
+		}
+	}
+	for _, name := range wantArrays {
+		if !slices.ContainsFunc(arrays, func(a mdArray) bool { return a.name == name }) {
+			problems = append(problems, name+" does not exist")
+		}
+	}
+	if len(arrays) == 0 && len(problems) == 0 {
+		summary = append(summary, "no software RAID arrays")
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"arrays": data})
+}
+
+// readMdstat parses the arrays in /proc/mdstat, e.g.
+//
+//	md0 : active raid1 sdb1[1] sda1[0](F)
+//	      1048512 blocks super 1.2 [2/1] [_U]
+//	      [=>...]  recovery =  8.5% (89600/1048512) finish=1.2min speed=12800K/sec
+func readMdstat(path string) ([]mdArray, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s does not exist: the md driver is not loaded", path)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var arrays []mdArray
+	var a *mdArray
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, rest, ok := strings.Cut(line, " : "); ok && !strings.HasPrefix(line, " ") {
+			a = nil
+			if name == "Personalities" {
+				continue
+			}
+			arrays = append(arrays, mdArray{name: name})
+			a = &arrays[len(arrays)-1]
+			fields := strings.Fields(rest)
+			if len(fields) > 0 {
+				a.state, fields = fields[0], fields[1:]
+			}
+			// "active (read-only)" and "active (auto-read-only)"
+			if len(fields) > 0 && strings.HasPrefix(fields[0], "(") {
+				a.state += " " + fields[0]
+				fields = fields[1:]
+			}
+			for _, field := range fields {
+				m := mdDeviceRE.FindStringSubmatch(field)
+				if m == nil {
+					a.level = field
+					continue
+				}
+				a.devices = append(a.devices, m[1])
+				switch m[2] {
+				case "(F)":
+					a.failed = append(a.failed, m[1])
+				case "(S)":
+					a.spares = append(a.spares, m[1])
+				}
+			}
+			continue
+		}
+		if a == nil {
+			continue
+		}
+		if m := mdCountRE.FindStringSubmatch(line); m != nil && a.want == 0 {
+			a.want, _ = strconv.Atoi(m[1])
+			a.working, _ = strconv.Atoi(m[2])
+		}
+		if m := mdSyncRE.FindStringSubmatch(line); m != nil {
+			a.sync = m[1]
+			a.progress, _ = strconv.ParseFloat(m[2], 64)
+			a.done, _ = strconv.ParseInt(m[3], 10, 64)
+			a.finish = m[4]
+			a.speed, _ = strconv.ParseInt(m[5], 10, 64)
+		}
+	}
+	return arrays, scanner.Err()
+}
+
+// mdadmState returns the "State :" line of "mdadm --detail" for an array,
+// e.g. "clean, degraded, recovering".
+func mdadmState(ctx context.Context, name string) (string, error) {
+	out, err := exec.CommandContext(ctx, "mdadm", "--detail", "/dev/"+name).Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(line, " : "); ok && strings.TrimSpace(key) == "State" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("mdadm --detail /dev/%s: no state", name)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// networkRunner checks the network interfaces and routes. Every arg other
+// than "default_route" names an interface and what it should be, as a
+// comma-separated list of "up" (administratively up and with a carrier) and
+// "mtu=N", e.g. bond0: "up,mtu=9000". args["default_route"] lists the
+// address families that need a default route, "ipv4" by default, and an
+// empty value checks none. It also fails when an address is assigned to
+// more than one interface or, on Linux, failed IPv6 duplicate address
+// detection.
+type networkRunner struct{}
+
+// interfaceExpectation is what an interface arg of the network check asks
+// for; mtu is 0 when it is not checked.
+type interfaceExpectation struct {
+	up  bool
+	mtu int
+}
+
+func (networkRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	families := listFlag{"ipv4"}
+	if s, ok := check.Args["default_route"]; ok {
+		families = nil
+		families.Set(s)
+	}
+	for _, family := range families {
+		if family != "ipv4" && family != "ipv6" {
+			return nativeError(fmt.Errorf("default_route: %q is not ipv4 or ipv6", family))
+		}
+	}
+	expected := make(map[string]interfaceExpectation)
+	var names []string
+	for name, spec := range check.Args {
+		if name == "default_route" {
+			continue
+		}
+		var terms listFlag
+		terms.Set(spec)
+		var e interfaceExpectation
+		for _, term := range terms {
+			switch value, ok := strings.CutPrefix(term, "mtu="); {
+			case term == "up":
+				e.up = true
+			case ok:
+				mtu, err := strconv.Atoi(value)
+				if err != nil || mtu < 1 {
+					return nativeError(fmt.Errorf("%s: %q is not an MTU", name, value))
+				}
+				e.mtu = mtu
+			default:
+				return nativeError(fmt.Errorf("%s: %q is not up or mtu=N", name, term))
+			}
+		}
+		expected[name] = e
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nativeError(err)
+	}
+	var summary, problems []string
+	var data []map[string]any
+	owners := make(map[string][]string)
+	for _, iface := range interfaces {
+		up, running := iface.Flags&net.FlagUp != 0, iface.Flags&net.FlagRunning != 0
+		var addresses []string
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nativeError(fmt.Errorf("%s: %v", iface.Name, err))
+		}
+		for _, addr := range addrs {
+			addresses = append(addresses, addr.String())
+			ip, _, err := net.ParseCIDR(addr.String())
+			// Link-local addresses are only unique on their link
+			if err == nil && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !slices.Contains(owners[ip.String()], iface.Name) {
+				owners[ip.String()] = append(owners[ip.String()], iface.Name)
+			}
+		}
+		data = append(data, map[string]any{
+			"name":      iface.Name,
+			"up":        up,
+			"running":   running,
+			"mtu":       iface.MTU,
+			"addresses": addresses,
+		})
+
+		e, ok := expected[iface.Name]
+		if !ok {
+			continue
+		}
+		line := fmt.Sprintf("%s: mtu %d", iface.Name, iface.MTU)
+		switch {
+		case !e.up:
+		case !up:
+			problems = append(problems, iface.Name+" is down")
+		case !running:
+			problems = append(problems, iface.Name+" is up but has no carrier")
+		default:
+			line = fmt.Sprintf("%s: up, mtu %d", iface.Name, iface.MTU)
+		}
+		if e.mtu != 0 && iface.MTU != e.mtu {
+			problems = append(problems, fmt.Sprintf("%s has MTU %d, want %d", iface.Name, iface.MTU, e.mtu))
+		}
+		summary = append(summary, line)
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(interfaces, func(iface net.Interface) bool { return iface.Name == name }) {
+			problems = append(problems, name+" does not exist")
+		}
+	}
+
+	duplicates := []string{}
+	for _, ip := range slices.Sorted(maps.Keys(owners)) {
+		if ifaces := owners[ip]; len(ifaces) > 1 {
+			duplicates = append(duplicates, ip)
+			problems = append(problems, fmt.Sprintf("%s is assigned to %s", ip, strings.Join(ifaces, " and ")))
+		}
+	}
+	dadFailed, err := dadFailedAddresses()
+	if err != nil {
+		return nativeError(err)
+	}
+	for _, iface := range slices.Sorted(maps.Keys(dadFailed)) {
+		for _, ip := range dadFailed[iface] {
+			duplicates = append(duplicates, ip)
+			problems = append(problems, fmt.Sprintf("%s on %s is used by another host on the link (duplicate address detection failed)", ip, iface))
+		}
+	}
+
+	routes := map[string]bool{}
+	if len(families) > 0 {
+		ipv4, ipv6, err := defaultRoutes()
+		if err != nil {
+			return nativeError(err)
+		}
+		routes["ipv4"], routes["ipv6"] = ipv4, ipv6
+		var present []string
+		for _, family := range []string{"ipv4", "ipv6"} {
+			name := strings.Replace(family, "ipv", "IPv", 1)
+			if routes[family] {
+				present = append(present, name)
+			} else if slices.Contains(families, family) {
+				problems = append(problems, "no "+name+" default route")
+			}
+		}
+		if len(present) > 0 {
+			summary = append(summary, "default routes: "+strings.Join(present, ", "))
+		}
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{
+		"interfaces":     data,
+		"default_routes": routes,
+		"duplicates":     duplicates,
+	})
+}
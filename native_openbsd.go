@@ -0,0 +1,15 @@
+package main
+
+import "syscall"
+
+// statfs returns the total, free and unprivileged-available bytes of the
+// filesystem holding path.
+func statfs(path string) (total, free, avail uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, 0, err
+	}
+	// f_bavail is negative when the reserved blocks are in use
+	bsize := uint64(st.F_bsize)
+	return st.F_blocks * bsize, st.F_bfree * bsize, uint64(max(st.F_bavail, 0)) * bsize, nil
+}
@@ -0,0 +1,28 @@
+//go:build !(linux || darwin || freebsd || openbsd)
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func statfs(path string) (total, free, avail uint64, err error) {
+	return 0, 0, 0, fmt.Errorf("disk usage is not supported on %s", runtime.GOOS)
+}
+
+func kernelRelease() (string, error) {
+	return "", fmt.Errorf("the kernel version is not supported on %s", runtime.GOOS)
+}
+
+func kernelOSVersion() string {
+	return ""
+}
+
+func defaultRoutes() (ipv4, ipv6 bool, err error) {
+	return false, false, fmt.Errorf("routes are not supported on %s", runtime.GOOS)
+}
+
+func dadFailedAddresses() (map[string][]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// listeningPortsRunner lists the TCP and UDP sockets listening on the host
+// from /proc/net, failing when one on a non-loopback address is not in
+// args["allow"]: comma-separated ports, optionally with a protocol, e.g.
+// "22,tcp/443,udp/53". The owning processes are named where /proc shows them.
+type listeningPortsRunner struct{}
+
+// socketTables are the /proc/net files listeningPortsRunner reads and the
+// state a listening socket has in each: LISTEN for TCP, and for UDP the
+// unconnected state of a bound socket.
+var socketTables = []struct{ proto, file, state string }{
+	{"tcp", "tcp", "0A"},
+	{"tcp", "tcp6", "0A"},
+	{"udp", "udp", "07"},
+	{"udp", "udp6", "07"},
+}
+
+// listeningSocket is a socket in a listening state.
+type listeningSocket struct {
+	proto string
+	ip    net.IP
+	port  int
+	inode string
+}
+
+func (listeningPortsRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	var allow listFlag
+	allow.Set(check.Args["allow"])
+	for _, entry := range allow {
+		if _, _, err := parsePortEntry(entry); err != nil {
+			return nativeError(fmt.Errorf("allow: %v", err))
+		}
+	}
+
+	var sockets []listeningSocket
+	for _, table := range socketTables {
+		found, err := readSocketTable(filepath.Join("/proc/net", table.file), table.proto, table.state)
+		if os.IsNotExist(err) && strings.HasSuffix(table.file, "6") {
+			// IPv6 is disabled
+			continue
+		}
+		if err != nil {
+			return nativeError(err)
+		}
+		sockets = append(sockets, found...)
+	}
+	processes := socketProcesses()
+
+	var summary, problems []string
+	var listeners []map[string]any
+	seen := make(map[string]bool)
+	for _, s := range sockets {
+		address := fmt.Sprintf("%s/%s", s.proto, net.JoinHostPort(s.ip.String(), strconv.Itoa(s.port)))
+		if seen[address] {
+			// SO_REUSEPORT listeners share an address
+			continue
+		}
+		seen[address] = true
+		process := processes[s.inode]
+		line := address
+		if process != "" {
+			line += " (" + process + ")"
+		}
+		exposed := !s.ip.IsLoopback()
+		summary = append(summary, line)
+		if exposed && !portAllowed(allow, s.proto, s.port) {
+			problems = append(problems, line+" is exposed")
+		}
+		listeners = append(listeners, map[string]any{
+			"protocol": s.proto,
+			"address":  s.ip.String(),
+			"port":     s.port,
+			"process":  process,
+			"exposed":  exposed,
+		})
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"listeners": listeners})
+}
+
+// parsePortEntry parses an allow entry, "22" or "tcp/22"; proto is empty
+// for any protocol.
+func parsePortEntry(entry string) (proto string, port int, err error) {
+	s := entry
+	if p, rest, ok := strings.Cut(entry, "/"); ok {
+		if p != "tcp" && p != "udp" {
+			return "", 0, fmt.Errorf("%q: unknown protocol %q (use tcp or udp)", entry, p)
+		}
+		proto, s = p, rest
+	}
+	port, err = strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("%q is not a port", entry)
+	}
+	return proto, port, nil
+}
+
+// portAllowed reports whether an allow entry covers proto and port.
+func portAllowed(allow []string, proto string, port int) bool {
+	return slices.ContainsFunc(allow, func(entry string) bool {
+		p, n, _ := parsePortEntry(entry)
+		return n == port && (p == "" || p == proto)
+	})
+}
+
+// readSocketTable returns the sockets in the given state from a
+// /proc/net/{tcp,udp}[6] file.
+func readSocketTable(path, proto, state string) ([]listeningSocket, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sockets []listeningSocket
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// e.g. "0: 00000000:0016 00000000:0000 0A ... 0 0 21453 ..."
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		hexIP, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		ip, err := parseProcIP(hexIP)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		sockets = append(sockets, listeningSocket{proto: proto, ip: ip, port: int(port), inode: fields[9]})
+	}
+	return sockets, scanner.Err()
+}
+
+// parseProcIP decodes an address from /proc/net, which prints it as 32-bit
+// words in host byte order.
+func parseProcIP(s string) (net.IP, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != net.IPv4len && len(b) != net.IPv6len {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(b[i:], binary.NativeEndian.Uint32(b[i:]))
+	}
+	return net.IP(b), nil
+}
+
+// socketProcesses maps socket inodes to the name and PID of a process
+// holding them open. Without root only kumo's own user's processes can be
+// seen.
+func socketProcesses() map[string]string {
+	processes := make(map[string]string)
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+		if _, ok := processes[inode]; ok {
+			continue
+		}
+		pid := strings.Split(fd, "/")[2]
+		comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		if err != nil {
+			continue
+		}
+		processes[inode] = fmt.Sprintf("%s[%s]", strings.TrimSpace(string(comm)), pid)
+	}
+	return processes
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sysctlBaseline is the kernel hardening baseline of the sysctl check:
+// each parameter and the values it may have, separated by "|".
+var sysctlBaseline = map[string]string{
+	"kernel.randomize_va_space":              "2",
+	"kernel.kptr_restrict":                   "1|2",
+	"kernel.dmesg_restrict":                  "1",
+	"kernel.yama.ptrace_scope":               "1|2|3",
+	"kernel.unprivileged_bpf_disabled":       "1|2",
+	"fs.protected_hardlinks":                 "1",
+	"fs.protected_symlinks":                  "1",
+	"fs.suid_dumpable":                       "0",
+	"net.ipv4.ip_forward":                    "0",
+	"net.ipv4.conf.all.rp_filter":            "1",
+	"net.ipv4.conf.default.rp_filter":        "1",
+	"net.ipv4.conf.all.accept_redirects":     "0",
+	"net.ipv4.conf.default.accept_redirects": "0",
+	"net.ipv4.conf.all.send_redirects":       "0",
+	"net.ipv4.conf.all.accept_source_route":  "0",
+	"net.ipv4.conf.all.log_martians":         "1",
+	"net.ipv4.icmp_echo_ignore_broadcasts":   "1",
+	"net.ipv4.tcp_syncookies":                "1",
+	"net.ipv6.conf.all.accept_redirects":     "0",
+	"net.ipv6.conf.all.accept_ra":            "0",
+}
+
+// sysctlRunner compares kernel parameters from /proc/sys with
+// sysctlBaseline. Every arg other than "baseline" names a parameter and the
+// values it may have, adding to or overriding the baseline, and an empty
+// value leaves the parameter out; baseline: "false" checks only the args.
+// Baseline parameters the kernel does not have are skipped. Without
+// /proc/sys, as on macOS and the BSDs, the check fails.
+type sysctlRunner struct{}
+
+func (sysctlRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	want := make(map[string]string)
+	explicit := make(map[string]bool)
+	switch check.Args["baseline"] {
+	case "", "true":
+		for key, value := range sysctlBaseline {
+			want[key] = value
+		}
+	case "false":
+	default:
+		return nativeError(fmt.Errorf("baseline: %q is not true or false", check.Args["baseline"]))
+	}
+	for key, value := range check.Args {
+		if key == "baseline" {
+			continue
+		}
+		if value == "" {
+			delete(want, key)
+			continue
+		}
+		want[key], explicit[key] = value, true
+	}
+	if len(want) == 0 {
+		return nativeError(fmt.Errorf("no parameters to check"))
+	}
+	if _, err := os.Stat("/proc/sys"); err != nil {
+		return nativeError(fmt.Errorf("kernel parameters are only read from /proc/sys on Linux: %w", err))
+	}
+
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var summary, problems []string
+	values := make(map[string]string)
+	for _, key := range keys {
+		got, err := readSysctl(key)
+		switch {
+		case os.IsNotExist(err) && !explicit[key]:
+			continue
+		case os.IsNotExist(err):
+			problems = append(problems, fmt.Sprintf("%s does not exist, want %s", key, want[key]))
+			continue
+		case err != nil:
+			return nativeError(err)
+		}
+		values[key] = got
+		if slices.Contains(strings.Split(want[key], "|"), got) {
+			summary = append(summary, key+" = "+got)
+		} else {
+			problems = append(problems, fmt.Sprintf("%s is %s, want %s", key, got, strings.ReplaceAll(want[key], "|", " or ")))
+		}
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"values": values})
+}
+
+// readSysctl reads a kernel parameter such as "net.ipv4.ip_forward", with
+// runs of whitespace in multi-value parameters collapsed to one space. As
+// with sysctl(8), a key whose first separator is "/" is separated by "/"
+// throughout, for names with dots like "net/ipv4/conf/eth0.100/rp_filter".
+func readSysctl(key string) (string, error) {
+	if i := strings.IndexAny(key, "./"); i < 0 || key[i] == '.' {
+		key = strings.ReplaceAll(key, ".", "/")
+	}
+	path := filepath.Join("/proc/sys", key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(data)), " "), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// worldWritableRunner scans the trees under args["roots"] (comma-separated,
+// "/" by default) for files and directories anyone may write to, except
+// directories with the sticky bit such as /tmp. Paths in args["exclude"]
+// are skipped with everything under them, and so are other filesystems
+// mounted below a root unless args["xdev"] is "false". At most
+// args["max_results"] (100 by default) paths are reported; the rest are
+// counted.
+type worldWritableRunner struct{}
+
+func (worldWritableRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	scan, err := newTreeScan(check.Args)
+	if err != nil {
+		return nativeError(err)
+	}
+	maxResults, err := maxResultsArg(check.Args)
+	if err != nil {
+		return nativeError(err)
+	}
+
+	found := []string{}
+	total := 0
+	err = scan.walk(ctx, func(path string, fi os.FileInfo) {
+		mode := fi.Mode()
+		if mode.Perm()&0o002 == 0 || !(mode.IsRegular() || mode.IsDir()) {
+			return
+		}
+		if mode.IsDir() && mode&os.ModeSticky != 0 {
+			return
+		}
+		total++
+		if len(found) < maxResults {
+			found = append(found, path)
+		}
+	})
+	if err != nil {
+		return nativeError(err)
+	}
+
+	var problems []string
+	if total > 0 {
+		problem := fmt.Sprintf("%d world-writable paths: %s", total, strings.Join(found, ", "))
+		if total > len(found) {
+			problem += fmt.Sprintf(" and %d more", total-len(found))
+		}
+		problems = append(problems, problem)
+	}
+	problems = append(problems, scan.problems...)
+	summary := fmt.Sprintf("no world-writable paths under %s", strings.Join(scan.roots, ", "))
+	return nativeResult(summary, problems, map[string]any{
+		"paths":      found,
+		"total":      total,
+		"truncated":  total > len(found),
+		"unreadable": scan.unreadable,
+	})
+}
+
+// maxResultsArg parses args["max_results"], the number of paths a scan
+// reports, 100 by default.
+func maxResultsArg(args map[string]string) (int, error) {
+	s, ok := args["max_results"]
+	if !ok {
+		return 100, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("max_results: %q is not a number", s)
+	}
+	return n, nil
+}
+
+// treeScan walks the directory trees of filesystem scans, configured by
+// the args "roots", "exclude" and "xdev".
+type treeScan struct {
+	roots   []string
+	exclude []string
+	xdev    bool
+	// Directories that could not be listed, and what went wrong with
+	// the roots
+	unreadable int
+	problems   []string
+}
+
+func newTreeScan(args map[string]string) (*treeScan, error) {
+	scan := &treeScan{roots: []string{"/"}, xdev: true}
+	if s, ok := args["roots"]; ok {
+		var roots listFlag
+		roots.Set(s)
+		if len(roots) == 0 {
+			return nil, fmt.Errorf("roots: no paths given")
+		}
+		scan.roots = roots
+	}
+	var exclude listFlag
+	exclude.Set(args["exclude"])
+	for _, path := range exclude {
+		if _, err := filepath.Match(path, ""); err != nil {
+			return nil, fmt.Errorf("exclude: %s: %v", path, err)
+		}
+		scan.exclude = append(scan.exclude, filepath.Clean(path))
+	}
+	switch args["xdev"] {
+	case "", "true":
+	case "false":
+		scan.xdev = false
+	default:
+		return nil, fmt.Errorf("xdev: %q is not true or false", args["xdev"])
+	}
+	return scan, nil
+}
+
+// matchesPath reports whether path is one of patterns or matches one of
+// them as a glob.
+func matchesPath(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, path); ok || pattern == path {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn with every path under the roots and its Lstat info,
+// symlinks included but not followed. Unreadable directories are counted
+// and skipped; the walk stops when ctx is done.
+func (s *treeScan) walk(ctx context.Context, fn func(path string, fi os.FileInfo)) error {
+	for _, root := range s.roots {
+		rootInfo, err := os.Lstat(root)
+		if err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("%s: %v", root, err))
+			continue
+		}
+		rootDev, hasDev := fileDevice(rootInfo)
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				// A directory that was visited but could not be listed
+				if d != nil && d.IsDir() {
+					s.unreadable++
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if matchesPath(s.exclude, path) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && s.xdev && hasDev && path != root {
+				if dev, ok := fileDevice(fi); ok && dev != rootDev {
+					return fs.SkipDir
+				}
+			}
+			fn(path, fi)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// smartRunner checks the SMART health of the disks in args["devices"]
+// (comma-separated, all that "smartctl --scan" finds by default, each
+// queried with the device type the scan reported) with smartctl's JSON
+// output. A disk fails when its overall assessment fails,
+// when it has more than args["max_reallocated"] reallocated sectors or
+// grown defects, more than args["max_pending"] pending or offline
+// uncorrectable sectors, or, on NVMe, a critical warning or more than
+// args["max_media_errors"] media errors (all 0 by default), and when its
+// latest self-test failed.
+type smartRunner struct{}
+
+// smartctlReport is the part of "smartctl --json" output the smart check
+// reads.
+type smartctlReport struct {
+	Smartctl struct {
+		Messages []struct{ String string }
+	}
+	Device struct {
+		Protocol string
+	}
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool
+	} `json:"smart_status"`
+	ATASmartAttributes struct {
+		Table []struct {
+			ID  int
+			Raw struct {
+				Value int64
+			}
+		}
+	} `json:"ata_smart_attributes"`
+	ATASelfTestLog struct {
+		Standard struct {
+			Table []struct {
+				Type   struct{ String string }
+				Status struct {
+					String string
+					Passed *bool
+				}
+			}
+		}
+	} `json:"ata_smart_self_test_log"`
+	NVMeHealth *struct {
+		CriticalWarning int   `json:"critical_warning"`
+		MediaErrors     int64 `json:"media_errors"`
+		PercentageUsed  int   `json:"percentage_used"`
+	} `json:"nvme_smart_health_information_log"`
+	NVMeSelfTestLog struct {
+		Table []struct {
+			SelfTestResult struct {
+				Value  int
+				String string
+			} `json:"self_test_result"`
+		}
+	} `json:"nvme_self_test_log"`
+	SCSIGrownDefectList *int64 `json:"scsi_grown_defect_list"`
+}
+
+// smartDevice is a disk to query and the smartctl device type to query it
+// with, as "smartctl --scan" lists them; Type is empty for devices given in
+// args.
+type smartDevice struct {
+	Name, Type string
+}
+
+// nvmeSelfTestFailures are the NVMe self-test results that mean a failure
+// rather than a test that completed or was aborted.
+var nvmeSelfTestFailures = []int{5, 6, 7}
+
+func (smartRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	limits := map[string]int64{"max_reallocated": 0, "max_pending": 0, "max_media_errors": 0}
+	for name := range limits {
+		if s, ok := check.Args[name]; ok {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 0 {
+				return nativeError(fmt.Errorf("%s: %q is not a number", name, s))
+			}
+			limits[name] = n
+		}
+	}
+
+	var names listFlag
+	names.Set(check.Args["devices"])
+	var devices []smartDevice
+	for _, name := range names {
+		devices = append(devices, smartDevice{Name: name})
+	}
+	if len(devices) == 0 {
+		var scan struct {
+			Devices []smartDevice
+		}
+		if err := smartctl(ctx, &scan, "--scan"); err != nil {
+			return nativeError(err)
+		}
+		devices = scan.Devices
+		if len(devices) == 0 {
+			return nativeError(fmt.Errorf("smartctl --scan found no devices"))
+		}
+	}
+	// Disks behind a RAID controller share the controller's device name
+	// and differ only by type, e.g. "megaraid,0"
+	shared := make(map[string]int)
+	for _, d := range devices {
+		shared[d.Name]++
+	}
+
+	var summary, problems []string
+	var disks []map[string]any
+	for _, d := range devices {
+		device := d.Name
+		if shared[d.Name] > 1 {
+			device += " [" + d.Type + "]"
+		}
+		args := []string{"--health", "--attributes", "--log=selftest", d.Name}
+		if d.Type != "" {
+			args = append([]string{"--device=" + d.Type}, args...)
+		}
+		var r smartctlReport
+		if err := smartctl(ctx, &r, args...); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", device, err))
+			continue
+		}
+		name := device
+		if r.ModelName != "" {
+			name += " (" + r.ModelName + ")"
+		}
+		disk := map[string]any{"device": d.Name, "type": d.Type, "model": r.ModelName, "serial": r.SerialNumber, "protocol": r.Device.Protocol}
+		issues := []string{}
+		if r.SmartStatus == nil {
+			issues = append(issues, "no SMART health assessment, SMART may be unsupported or off")
+		} else {
+			disk["passed"] = r.SmartStatus.Passed
+			if !r.SmartStatus.Passed {
+				issues = append(issues, "SMART overall health assessment FAILED")
+			}
+		}
+
+		var reallocated, pending int64
+		for _, a := range r.ATASmartAttributes.Table {
+			switch a.ID {
+			case 5:
+				reallocated += a.Raw.Value
+			case 197, 198:
+				pending += a.Raw.Value
+			}
+		}
+		if r.SCSIGrownDefectList != nil {
+			reallocated += *r.SCSIGrownDefectList
+		}
+		disk["reallocated"], disk["pending"] = reallocated, pending
+		if reallocated > limits["max_reallocated"] {
+			issues = append(issues, fmt.Sprintf("%d reallocated sectors (limit %d)", reallocated, limits["max_reallocated"]))
+		}
+		if pending > limits["max_pending"] {
+			issues = append(issues, fmt.Sprintf("%d pending or uncorrectable sectors (limit %d)", pending, limits["max_pending"]))
+		}
+		if h := r.NVMeHealth; h != nil {
+			disk["media_errors"], disk["percentage_used"] = h.MediaErrors, h.PercentageUsed
+			if h.CriticalWarning != 0 {
+				issues = append(issues, fmt.Sprintf("NVMe critical warning 0x%02x", h.CriticalWarning))
+			}
+			if h.MediaErrors > limits["max_media_errors"] {
+				issues = append(issues, fmt.Sprintf("%d media errors (limit %d)", h.MediaErrors, limits["max_media_errors"]))
+			}
+		}
+
+		// The logs list the latest self-test first
+		if tests := r.ATASelfTestLog.Standard.Table; len(tests) > 0 {
+			disk["last_self_test"] = tests[0].Status.String
+			if p := tests[0].Status.Passed; p != nil && !*p {
+				issues = append(issues, fmt.Sprintf("latest %s self-test failed: %s", tests[0].Type.String, tests[0].Status.String))
+			}
+		}
+		if tests := r.NVMeSelfTestLog.Table; len(tests) > 0 {
+			disk["last_self_test"] = tests[0].SelfTestResult.String
+			if slices.Contains(nvmeSelfTestFailures, tests[0].SelfTestResult.Value) {
+				issues = append(issues, "latest self-test failed: "+tests[0].SelfTestResult.String)
+			}
+		}
+
+		disk["problems"] = issues
+		disks = append(disks, disk)
+		for _, issue := range issues {
+			problems = append(problems, name+": "+issue)
+		}
+		if len(issues) == 0 {
+			summary = append(summary, fmt.Sprintf("%s: passed, %d reallocated, %d pending", name, reallocated, pending))
+		}
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"disks": disks})
+}
+
+// smartctl runs smartctl with --json and args and decodes its output into
+// v. smartctl's exit status is a bit mask: only the two lowest bits, a bad
+// command line or a device that could not be opened, mean that there is
+// no report; the others flag what the report shows.
+func smartctl(ctx context.Context, v any, args ...string) error {
+	out, err := exec.CommandContext(ctx, "smartctl", append([]string{"--json=c"}, args...)...).Output()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return fmt.Errorf("smartctl: %v", err)
+	}
+	fatal := exitErr != nil && exitErr.ExitCode()&0b11 != 0
+	if jsonErr := json.Unmarshal(out, v); jsonErr != nil && !fatal {
+		return fmt.Errorf("smartctl: %v", jsonErr)
+	}
+	if fatal {
+		var report smartctlReport
+		json.Unmarshal(out, &report)
+		var messages []string
+		for _, m := range report.Smartctl.Messages {
+			messages = append(messages, m.String)
+		}
+		if len(messages) > 0 {
+			return fmt.Errorf("smartctl: %s", strings.Join(messages, "; "))
+		}
+		return fmt.Errorf("smartctl: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sshdConfigRunner checks the sshd_config at args["path"]
+// (/etc/ssh/sshd_config by default) against a policy. Every other arg
+// names a keyword and the values it may have, separated by "|", or a
+// numeric limit such as "<=4", e.g. PermitRootLogin: "no". Keywords that
+// are not set are compared by their sshd default. args["allowed_ciphers"],
+// args["allowed_macs"] and args["allowed_kex"] list the algorithms that
+// Ciphers, MACs and KexAlgorithms may enable. Match blocks are checked too:
+// a block that overrides a keyword of the policy must also satisfy it.
+type sshdConfigRunner struct{}
+
+// sshdDefaults are the values sshd uses for keywords that are not set,
+// as of OpenSSH 9.
+var sshdDefaults = map[string]string{
+	"allowagentforwarding":            "yes",
+	"allowtcpforwarding":              "yes",
+	"challengeresponseauthentication": "yes",
+	"clientalivecountmax":             "3",
+	"clientaliveinterval":             "0",
+	"gatewayports":                    "no",
+	"hostbasedauthentication":         "no",
+	"ignorerhosts":                    "yes",
+	"kbdinteractiveauthentication":    "yes",
+	"logingracetime":                  "120",
+	"loglevel":                        "INFO",
+	"maxauthtries":                    "6",
+	"maxsessions":                     "10",
+	"passwordauthentication":          "yes",
+	"permitemptypasswords":            "no",
+	"permitrootlogin":                 "prohibit-password",
+	"permittunnel":                    "no",
+	"permituserenvironment":           "no",
+	"port":                            "22",
+	"protocol":                        "2",
+	"pubkeyauthentication":            "yes",
+	"strictmodes":                     "yes",
+	"x11forwarding":                   "no",
+}
+
+// sshdAlgorithmArgs map the allowed_* args to the keywords they limit.
+var sshdAlgorithmArgs = map[string]string{
+	"allowed_ciphers": "Ciphers",
+	"allowed_macs":    "MACs",
+	"allowed_kex":     "KexAlgorithms",
+}
+
+// sshdConfig is a parsed sshd_config, keyed by lowercased keyword. As in
+// sshd the first value of a keyword wins, in the global section and in
+// each Match block.
+type sshdConfig struct {
+	global  map[string]string
+	matches []sshdMatch
+}
+
+// sshdMatch is a Match block: its criteria, e.g. "User backup", and the
+// settings it overrides.
+type sshdMatch struct {
+	criteria string
+	settings map[string]string
+}
+
+func (sshdConfigRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	path := check.Args["path"]
+	if path == "" {
+		path = "/etc/ssh/sshd_config"
+	}
+	config := &sshdConfig{global: make(map[string]string)}
+	if err := parseSSHDConfig(path, config, config.global, 0); err != nil {
+		return nativeError(err)
+	}
+
+	var keywords []string
+	for keyword := range check.Args {
+		if keyword != "path" && sshdAlgorithmArgs[keyword] == "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	slices.Sort(keywords)
+
+	var summary, problems []string
+	for _, keyword := range keywords {
+		want := check.Args[keyword]
+		got, ok := config.global[strings.ToLower(keyword)]
+		source := ""
+		if !ok {
+			got, ok = sshdDefaults[strings.ToLower(keyword)]
+			source = " (default)"
+		}
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s is not set, want %s", keyword, sshdWantText(want)))
+		case !sshdValueAllowed(got, want):
+			problems = append(problems, fmt.Sprintf("%s is %s%s, want %s", keyword, got, source, sshdWantText(want)))
+		default:
+			summary = append(summary, keyword+" "+got+source)
+		}
+		for _, m := range config.matches {
+			if got, ok := m.settings[strings.ToLower(keyword)]; ok && !sshdValueAllowed(got, want) {
+				problems = append(problems, fmt.Sprintf("Match %s: %s is %s, want %s", m.criteria, keyword, got, sshdWantText(want)))
+			}
+		}
+	}
+
+	var algorithmArgs []string
+	for arg := range sshdAlgorithmArgs {
+		if _, ok := check.Args[arg]; ok {
+			algorithmArgs = append(algorithmArgs, arg)
+		}
+	}
+	slices.Sort(algorithmArgs)
+	for _, arg := range algorithmArgs {
+		keyword := sshdAlgorithmArgs[arg]
+		var allowed listFlag
+		allowed.Set(check.Args[arg])
+		value, ok := config.global[strings.ToLower(keyword)]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s is not set, so the sshd defaults apply", keyword))
+			continue
+		case strings.HasPrefix(value, "-"):
+			problems = append(problems, fmt.Sprintf("%s only removes algorithms from the sshd defaults", keyword))
+			continue
+		}
+		// "+" appends to and "^" prepends to the defaults, which are not
+		// checked; the listed algorithms are
+		var disallowed []string
+		for _, algorithm := range strings.Split(strings.TrimLeft(value, "+^"), ",") {
+			if !slices.Contains(allowed, algorithm) {
+				disallowed = append(disallowed, algorithm)
+			}
+		}
+		if len(disallowed) > 0 {
+			problems = append(problems, fmt.Sprintf("%s allows %s", keyword, strings.Join(disallowed, ", ")))
+		} else {
+			summary = append(summary, keyword+" "+value)
+		}
+	}
+
+	matches := make([]map[string]any, 0, len(config.matches))
+	for _, m := range config.matches {
+		matches = append(matches, map[string]any{"criteria": m.criteria, "settings": m.settings})
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"settings": config.global, "matches": matches})
+}
+
+// sshdValueAllowed reports whether got satisfies want: one of its
+// "|"-separated values, compared case-insensitively, or a numeric limit
+// like "<=4".
+func sshdValueAllowed(got, want string) bool {
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		s, ok := strings.CutPrefix(want, op)
+		if !ok {
+			continue
+		}
+		limit, err1 := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		n, err2 := strconv.ParseFloat(got, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		return comparisons[op](n, limit)
+	}
+	return slices.ContainsFunc(strings.Split(want, "|"), func(w string) bool {
+		return strings.EqualFold(got, w)
+	})
+}
+
+// sshdWantText describes the values of a policy for messages.
+func sshdWantText(want string) string {
+	return strings.ReplaceAll(want, "|", " or ")
+}
+
+// sshdMaxIncludeDepth is how deeply sshd nests Include directives.
+const sshdMaxIncludeDepth = 16
+
+// parseSSHDConfig adds the settings of the sshd_config at path to config,
+// starting in the block settings: the global section or a Match block. As
+// in sshd, Include directives are followed, with relative patterns under
+// /etc/ssh, and an included file starts in the block of the Include and
+// does not change it for the including file. depth counts the Includes
+// that led to path; like sshd, it gives up past sshdMaxIncludeDepth, which
+// also stops a file that includes itself.
+func parseSSHDConfig(path string, config *sshdConfig, settings map[string]string, depth int) error {
+	if depth > sshdMaxIncludeDepth {
+		return fmt.Errorf("%s: Include nested too deeply", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Keyword and value are separated by whitespace, a single "=" or
+		// both
+		keyword, value := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			keyword, value = line[:i], strings.TrimLeft(line[i:], " \t")
+			value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+		}
+		keyword, value = strings.ToLower(keyword), strings.Trim(value, `"`)
+		switch keyword {
+		case "match":
+			config.matches = append(config.matches, sshdMatch{criteria: value, settings: make(map[string]string)})
+			settings = config.matches[len(config.matches)-1].settings
+			continue
+		case "include":
+			for _, pattern := range strings.Fields(value) {
+				// sshd resolves relative patterns against /etc/ssh, not
+				// the including file's directory
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join("/etc/ssh", pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, match := range matches {
+					if err := parseSSHDConfig(match, config, settings, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+		if _, ok := settings[keyword]; !ok {
+			settings[keyword] = value
+		}
+	}
+	return scanner.Err()
+}
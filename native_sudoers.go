@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// sudoersRunner audits the sudoers file at args["path"] (/etc/sudoers by
+// default) and the files it includes. It reports every rule that grants ALL
+// commands without a password or allows commands with wildcards, and fails
+// when a setting in args["require"] (comma-separated, "requiretty,logfile"
+// by default) is not enabled by a global Defaults line.
+type sudoersRunner struct{}
+
+// sudoersLine is a logical line of a sudoers file, continuations joined.
+type sudoersLine struct {
+	file string
+	line int
+	text string
+}
+
+// sudoersTag matches the tags in front of a command, e.g. "NOPASSWD:".
+var sudoersTag = regexp.MustCompile(`^([A-Z_]+):\s*`)
+
+func (sudoersRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	path := check.Args["path"]
+	if path == "" {
+		path = "/etc/sudoers"
+	}
+	require := listFlag{"requiretty", "logfile"}
+	if s, ok := check.Args["require"]; ok {
+		require = nil
+		require.Set(s)
+	}
+
+	var lines []sudoersLine
+	if err := readSudoers(path, &lines, 0); err != nil {
+		return nativeError(err)
+	}
+
+	var problems, nopasswd, wildcards []string
+	defaults := make(map[string]bool)
+	rules := 0
+	for _, l := range lines {
+		where := fmt.Sprintf("%s:%d", l.file, l.line)
+		keyword, rest, _ := strings.Cut(l.text, " ")
+		switch {
+		case keyword == "Defaults":
+			// Only unqualified Defaults apply to everyone, not
+			// "Defaults:user" and the like
+			for _, setting := range strings.Split(rest, ",") {
+				name, _, _ := strings.Cut(strings.TrimSpace(setting), "=")
+				name = strings.TrimSpace(name)
+				if enabled := !strings.HasPrefix(name, "!"); enabled {
+					defaults[name] = true
+				} else {
+					delete(defaults, strings.TrimPrefix(name, "!"))
+				}
+			}
+		case strings.HasPrefix(keyword, "Defaults"), strings.HasSuffix(keyword, "_Alias") && keyword != "Cmnd_Alias":
+		case keyword == "Cmnd_Alias":
+			// NAME = cmnd, cmnd : NAME = cmnd
+			for _, alias := range strings.Split(rest, ":") {
+				_, cmnds, _ := strings.Cut(alias, "=")
+				for _, cmnd := range splitSudoersList(cmnds) {
+					if isWildcardCommand(cmnd) {
+						wildcards = append(wildcards, where)
+						problems = append(problems, fmt.Sprintf("%s: command alias with a wildcard: %s", where, cmnd))
+					}
+				}
+			}
+		default:
+			// who hosts = (runas) TAG: cmnd, cmnd
+			_, spec, ok := strings.Cut(l.text, "=")
+			if !ok {
+				continue
+			}
+			rules++
+			noPassword := false
+			for _, item := range splitSudoersList(spec) {
+				if strings.HasPrefix(item, "(") {
+					if i := strings.Index(item, ")"); i >= 0 {
+						item = strings.TrimSpace(item[i+1:])
+					}
+				}
+				// Tags carry over to the following commands
+				for m := sudoersTag.FindStringSubmatch(item); m != nil; m = sudoersTag.FindStringSubmatch(item) {
+					switch m[1] {
+					case "NOPASSWD":
+						noPassword = true
+					case "PASSWD":
+						noPassword = false
+					}
+					item = item[len(m[0]):]
+				}
+				switch {
+				case item == "ALL" && noPassword:
+					nopasswd = append(nopasswd, where)
+					problems = append(problems, fmt.Sprintf("%s: NOPASSWD for ALL commands: %s", where, l.text))
+				case isWildcardCommand(item):
+					wildcards = append(wildcards, where)
+					problems = append(problems, fmt.Sprintf("%s: command with a wildcard: %s", where, l.text))
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for _, name := range require {
+		if !defaults[name] {
+			missing = append(missing, name)
+			problems = append(problems, fmt.Sprintf("Defaults %s is not set", name))
+		}
+	}
+	files := []string{}
+	for _, l := range lines {
+		if !slices.Contains(files, l.file) {
+			files = append(files, l.file)
+		}
+	}
+	summary := fmt.Sprintf("%d rules in %s", rules, strings.Join(files, ", "))
+	return nativeResult(summary, problems, map[string]any{
+		"files":            files,
+		"rules":            rules,
+		"nopasswd_all":     nopasswd,
+		"wildcards":        wildcards,
+		"missing_defaults": missing,
+	})
+}
+
+// splitSudoersList splits a comma-separated list of commands, honoring
+// backslash-escaped commas.
+func splitSudoersList(s string) []string {
+	var items []string
+	var item strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			item.WriteByte(s[i])
+			item.WriteByte(s[i+1])
+			i++
+		case s[i] == ',':
+			items = append(items, strings.TrimSpace(item.String()))
+			item.Reset()
+		default:
+			item.WriteByte(s[i])
+		}
+	}
+	return append(items, strings.TrimSpace(item.String()))
+}
+
+// isWildcardCommand reports whether a sudoers command uses shell-style
+// wildcards, which usually allow far more than intended. Negated commands
+// only take permissions away.
+func isWildcardCommand(cmnd string) bool {
+	return !strings.HasPrefix(cmnd, "!") && strings.ContainsAny(cmnd, "*?[")
+}
+
+// readSudoers appends the logical lines of the sudoers file at path to
+// lines, following @include and @includedir (or their #include forms).
+// As in sudo, files in an included directory are read in lexical order,
+// except those whose names end in "~" or contain a ".".
+func readSudoers(path string, lines *[]sudoersLine, depth int) error {
+	if depth > 8 {
+		return fmt.Errorf("%s: includes nested too deeply", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var text strings.Builder
+	start := 0
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if text.Len() == 0 {
+			start = n
+		}
+		if strings.HasSuffix(line, "\\") {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+			continue
+		}
+		text.WriteString(line)
+		full := strings.Join(strings.Fields(text.String()), " ")
+		text.Reset()
+
+		directive, arg, _ := strings.Cut(full, " ")
+		switch directive {
+		case "@include", "#include":
+			if !filepath.IsAbs(arg) {
+				arg = filepath.Join(filepath.Dir(path), arg)
+			}
+			if err := readSudoers(arg, lines, depth+1); err != nil {
+				return err
+			}
+			continue
+		case "@includedir", "#includedir":
+			if !filepath.IsAbs(arg) {
+				arg = filepath.Join(filepath.Dir(path), arg)
+			}
+			entries, err := os.ReadDir(arg)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for _, e := range entries {
+				if e.IsDir() || strings.HasSuffix(e.Name(), "~") || strings.Contains(e.Name(), ".") {
+					continue
+				}
+				if err := readSudoers(filepath.Join(arg, e.Name()), lines, depth+1); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		full = stripSudoersComment(full)
+		if full != "" {
+			*lines = append(*lines, sudoersLine{file: path, line: start, text: full})
+		}
+	}
+	return scanner.Err()
+}
+
+// stripSudoersComment removes a comment from a line. "#" followed by a
+// digit is a UID, as in "#1000 ALL = ALL", not a comment.
+func stripSudoersComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ') && (i+1 == len(line) || line[i+1] < '0' || line[i+1] > '9') {
+			return strings.TrimSpace(line[:i])
+		}
+	}
+	return line
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// suidFilesRunner inventories the setuid and setgid files under
+// args["roots"] ("/" by default, with args["exclude"] and args["xdev"] as
+// for world_writable) and compares them with the baseline file at
+// args["baseline"] (/var/lib/kumo/suid-baseline by default). It fails when
+// a file is neither in the baseline nor matches args["allow"]. Without a
+// baseline file, or with args["update"] "true", the inventory is recorded
+// as the new baseline instead.
+type suidFilesRunner struct{}
+
+func (suidFilesRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	scan, err := newTreeScan(check.Args)
+	if err != nil {
+		return nativeError(err)
+	}
+	maxResults, err := maxResultsArg(check.Args)
+	if err != nil {
+		return nativeError(err)
+	}
+	baselinePath := check.Args["baseline"]
+	if baselinePath == "" {
+		baselinePath = "/var/lib/kumo/suid-baseline"
+	}
+	var allow listFlag
+	allow.Set(check.Args["allow"])
+	update := false
+	switch check.Args["update"] {
+	case "", "false":
+	case "true":
+		update = true
+	default:
+		return nativeError(fmt.Errorf("update: %q is not true or false", check.Args["update"]))
+	}
+
+	var found []string
+	files := []map[string]any{}
+	err = scan.walk(ctx, func(path string, fi os.FileInfo) {
+		mode := fi.Mode()
+		if !mode.IsRegular() || mode&(os.ModeSetuid|os.ModeSetgid) == 0 {
+			return
+		}
+		found = append(found, path)
+		files = append(files, map[string]any{"path": path, "mode": fmt.Sprintf("%04o", unixMode(mode))})
+	})
+	if err != nil {
+		return nativeError(err)
+	}
+	slices.Sort(found)
+
+	baseline, err := readBaseline(baselinePath)
+	if os.IsNotExist(err) {
+		update = true
+	} else if err != nil {
+		return nativeError(err)
+	}
+	data := map[string]any{"files": files, "baseline": baselinePath}
+	if update {
+		if err := writeBaseline(baselinePath, found); err != nil {
+			return nativeError(err)
+		}
+		data["recorded"] = true
+		summary := fmt.Sprintf("recorded %d setuid and setgid files as the baseline in %s", len(found), baselinePath)
+		return nativeResult(summary, scan.problems, data)
+	}
+
+	added, removed := []string{}, []string{}
+	for _, path := range found {
+		if !slices.Contains(baseline, path) && !matchesPath(allow, path) {
+			added = append(added, path)
+		}
+	}
+	for _, path := range baseline {
+		if _, found := slices.BinarySearch(found, path); !found {
+			removed = append(removed, path)
+		}
+	}
+	data["new"], data["removed"] = added, removed
+
+	var problems []string
+	if len(added) > 0 {
+		problem := fmt.Sprintf("%d setuid or setgid files not in the baseline: %s", len(added), strings.Join(added[:min(len(added), maxResults)], ", "))
+		if len(added) > maxResults {
+			problem += fmt.Sprintf(" and %d more", len(added)-maxResults)
+		}
+		problems = append(problems, problem)
+	}
+	problems = append(problems, scan.problems...)
+	summary := fmt.Sprintf("%d setuid and setgid files, all in the baseline", len(found))
+	if len(removed) > 0 {
+		summary += fmt.Sprintf("; %d baseline files are gone: %s", len(removed), strings.Join(removed, ", "))
+	}
+	return nativeResult(summary, problems, data)
+}
+
+// readBaseline reads a baseline file: one path per line, ignoring blank
+// lines and comments.
+func readBaseline(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, line)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// writeBaseline replaces the baseline file at path with paths, creating its
+// directory if needed.
+func writeBaseline(path string, paths []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("# setuid and setgid files expected on this host, recorded by kumo\n")
+	for _, p := range paths {
+		b.WriteString(p + "\n")
+	}
+	return writeFileAtomic(path, []byte(b.String()), 0o600)
+}
@@ -0,0 +1,45 @@
+//go:build darwin || freebsd || openbsd
+
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// kernelRelease returns the running kernel's release, e.g. "23.6.0" on
+// macOS or "14.1-RELEASE" on FreeBSD.
+func kernelRelease() (string, error) {
+	return syscall.Sysctl("kern.osrelease")
+}
+
+// kernelOSVersion returns the OS version where there is no os-release file:
+// the product version, e.g. "14.6.1", on macOS and the kernel release on
+// the BSDs.
+func kernelOSVersion() string {
+	name := "kern.osrelease"
+	if runtime.GOOS == "darwin" {
+		name = "kern.osproductversion"
+	}
+	version, _ := syscall.Sysctl(name)
+	return version
+}
+
+// defaultRoutes reports whether "route get" finds an IPv4 and an IPv6
+// default route.
+func defaultRoutes() (ipv4, ipv6 bool, err error) {
+	if err := exec.Command("route", "-n", "get", "default").Run(); err == nil {
+		ipv4 = true
+	} else if _, ok := err.(*exec.ExitError); !ok {
+		return false, false, err
+	}
+	ipv6 = exec.Command("route", "-n", "get", "-inet6", "default").Run() == nil
+	return ipv4, ipv6, nil
+}
+
+// dadFailedAddresses is not supported here: the BSDs only mark duplicated
+// addresses in ifconfig's output.
+func dadFailedAddresses() (map[string][]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// systemdUnitsRunner checks the health of the systemd units in
+// args["units"] (comma-separated, ".service" by default): each must be
+// loaded, active and, unless args["enabled"] is "false", enabled, and must
+// not have been restarted automatically more than args["max_restarts"]
+// times (0 by default), which catches crash loops. The units are queried
+// with "systemctl show".
+type systemdUnitsRunner struct{}
+
+// systemdUnitProperties are the properties systemdUnitsRunner reads.
+var systemdUnitProperties = []string{"Id", "LoadState", "ActiveState", "SubState", "UnitFileState", "NRestarts"}
+
+// enabledUnitFileStates are the UnitFileState values of units that start
+// without being enabled by hand, e.g. static units pulled in by others.
+var enabledUnitFileStates = []string{"enabled", "enabled-runtime", "static", "generated", "alias"}
+
+func (systemdUnitsRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	var units listFlag
+	units.Set(check.Args["units"])
+	if len(units) == 0 {
+		return nativeError(fmt.Errorf("units: no units given"))
+	}
+	maxRestarts := 0
+	if s, ok := check.Args["max_restarts"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nativeError(fmt.Errorf("max_restarts: %q is not a number", s))
+		}
+		maxRestarts = n
+	}
+	requireEnabled := check.Args["enabled"] != "false"
+
+	args := []string{"show", "--property=" + strings.Join(systemdUnitProperties, ","), "--"}
+	states, err := systemctlShow(ctx, append(args, units...))
+	if err != nil {
+		return nativeError(err)
+	}
+	if len(states) != len(units) {
+		return nativeError(fmt.Errorf("systemctl show returned %d units, want %d", len(states), len(units)))
+	}
+
+	var summary, problems []string
+	var data []map[string]any
+	for i, state := range states {
+		name := state["Id"]
+		if name == "" {
+			name = units[i]
+		}
+		restarts, _ := strconv.Atoi(state["NRestarts"])
+		data = append(data, map[string]any{
+			"unit":            name,
+			"load_state":      state["LoadState"],
+			"active_state":    state["ActiveState"],
+			"sub_state":       state["SubState"],
+			"unit_file_state": state["UnitFileState"],
+			"restarts":        restarts,
+		})
+		if state["LoadState"] != "loaded" {
+			problems = append(problems, fmt.Sprintf("%s is %s", name, state["LoadState"]))
+			continue
+		}
+		summary = append(summary, fmt.Sprintf("%s: %s (%s), %s, %d restarts", name, state["ActiveState"], state["SubState"], state["UnitFileState"], restarts))
+		if state["ActiveState"] != "active" {
+			problems = append(problems, fmt.Sprintf("%s is %s (%s)", name, state["ActiveState"], state["SubState"]))
+		}
+		if requireEnabled && !slices.Contains(enabledUnitFileStates, state["UnitFileState"]) {
+			problems = append(problems, fmt.Sprintf("%s is %s, not enabled", name, state["UnitFileState"]))
+		}
+		if restarts > maxRestarts {
+			problems = append(problems, fmt.Sprintf("%s was restarted %d times (limit %d)", name, restarts, maxRestarts))
+		}
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"units": data})
+}
+
+// systemctlShow runs systemctl with args and parses its "show" output:
+// one block of Key=Value lines per unit, separated by blank lines.
+func systemctlShow(ctx context.Context, args []string) ([]map[string]string, error) {
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, "systemctl", args...)
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("systemctl: %s", msg)
+		}
+		return nil, fmt.Errorf("systemctl: %v", err)
+	}
+
+	var units []map[string]string
+	var unit map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			unit = nil
+			continue
+		}
+		if unit == nil {
+			unit = make(map[string]string)
+			units = append(units, unit)
+		}
+		unit[key] = value
+	}
+	return units, scanner.Err()
+}
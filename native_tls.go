@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tlsCertRunner reports the certificates served by args["endpoints"]
+// (comma-separated host:port, port 443 by default) and stored in the PEM
+// files args["files"], failing when one expires within args["min_days"]
+// (30 by default). args["server_name"] overrides the SNI name sent to the
+// endpoints. Trust is not verified, so that expired and self-signed
+// certificates are still reported.
+type tlsCertRunner struct{}
+
+func (tlsCertRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	minDays := 30
+	if s, ok := check.Args["min_days"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nativeError(fmt.Errorf("min_days: %q is not a number of days", s))
+		}
+		minDays = n
+	}
+	var endpoints, files listFlag
+	endpoints.Set(check.Args["endpoints"])
+	files.Set(check.Args["files"])
+	if len(endpoints) == 0 && len(files) == 0 {
+		return nativeError(fmt.Errorf("set endpoints or files"))
+	}
+
+	var summary, problems []string
+	var certificates []map[string]any
+	add := func(source string, cert *x509.Certificate) {
+		days := int(time.Until(cert.NotAfter).Hours() / 24)
+		issuer := cert.Issuer.CommonName
+		if issuer == "" {
+			issuer = cert.Issuer.String()
+		}
+		sans := certNames(cert)
+		expires := cert.NotAfter.UTC().Format(time.DateOnly)
+		summary = append(summary, fmt.Sprintf("%s: expires in %d days (%s), issuer %s, SANs %s", source, days, expires, issuer, strings.Join(sans, ", ")))
+		switch {
+		case time.Now().After(cert.NotAfter):
+			problems = append(problems, fmt.Sprintf("%s expired on %s", source, expires))
+		case days < minDays:
+			problems = append(problems, fmt.Sprintf("%s expires in %d days (limit %d)", source, days, minDays))
+		}
+		certificates = append(certificates, map[string]any{
+			"source":         source,
+			"subject":        cert.Subject.String(),
+			"issuer":         cert.Issuer.String(),
+			"sans":           sans,
+			"not_after":      cert.NotAfter.UTC().Format(time.RFC3339),
+			"days_remaining": days,
+		})
+	}
+
+	for _, endpoint := range endpoints {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			endpoint = net.JoinHostPort(endpoint, "443")
+		}
+		cert, err := fetchCertificate(ctx, endpoint, check.Args["server_name"])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", endpoint, err))
+			continue
+		}
+		add(endpoint, cert)
+	}
+	for _, path := range files {
+		certs, err := readCertificates(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		for i, cert := range certs {
+			source := path
+			if len(certs) > 1 {
+				source = fmt.Sprintf("%s[%d]", path, i)
+			}
+			add(source, cert)
+		}
+	}
+	return nativeResult(strings.Join(summary, "\n"), problems, map[string]any{"certificates": certificates})
+}
+
+// fetchCertificate returns the leaf certificate served at endpoint, sending
+// serverName (or the endpoint's host) as SNI.
+func fetchCertificate(ctx context.Context, endpoint, serverName string) (*x509.Certificate, error) {
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(endpoint)
+	}
+	dialer := tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 10 * time.Second},
+		Config:    &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate presented")
+	}
+	return certs[0], nil
+}
+
+// readCertificates parses every certificate in the PEM file at path.
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return certs, nil
+}
+
+// certNames lists the DNS names and IP addresses a certificate is valid for.
+func certNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
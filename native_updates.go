@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// securityUpdatesRunner reports the pending updates of the system's package
+// manager (apt, dnf, yum, zypper, apk or pacman, or args["manager"]),
+// separating security updates from the rest. It fails when more than
+// args["max_security"] (0 by default) security updates or, when set, more
+// than args["max_updates"] updates in total are pending. The package lists
+// are not refreshed, except where dnf and yum refresh expired metadata
+// themselves.
+type securityUpdatesRunner struct{}
+
+// packageManager lists the pending updates of one package manager. security
+// is nil when the manager cannot tell security updates apart, and names
+// patches rather than packages when patches is set.
+type packageManager struct {
+	command string
+	pending func(ctx context.Context) (security, all []string, err error)
+	patches bool
+}
+
+// packageManagers are tried in order; the first one installed is used.
+var packageManagers = []packageManager{
+	{"apt-get", aptUpdates, false},
+	{"dnf", func(ctx context.Context) ([]string, []string, error) { return yumUpdates(ctx, "dnf") }, false},
+	{"yum", func(ctx context.Context) ([]string, []string, error) { return yumUpdates(ctx, "yum") }, false},
+	{"zypper", zypperUpdates, true},
+	{"apk", apkUpdates, false},
+	{"pacman", pacmanUpdates, false},
+}
+
+func (securityUpdatesRunner) Run(ctx context.Context, check Check, env []string) commandResult {
+	maxSecurity, maxUpdates := 0, -1
+	for name, limit := range map[string]*int{"max_security": &maxSecurity, "max_updates": &maxUpdates} {
+		if s, ok := check.Args[name]; ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return nativeError(fmt.Errorf("%s: %q is not a number", name, s))
+			}
+			*limit = n
+		}
+	}
+
+	var manager *packageManager
+	for i, m := range packageManagers {
+		if want := check.Args["manager"]; want != "" && m.command != want {
+			continue
+		}
+		if _, err := exec.LookPath(m.command); err == nil {
+			manager = &packageManagers[i]
+			break
+		}
+	}
+	if manager == nil {
+		if want := check.Args["manager"]; want != "" {
+			return nativeError(fmt.Errorf("manager: %s is not installed", want))
+		}
+		return nativeError(fmt.Errorf("no supported package manager found (apt, dnf, yum, zypper, apk or pacman)"))
+	}
+
+	security, all, err := manager.pending(ctx)
+	if err != nil {
+		return nativeError(err)
+	}
+	// Patches cannot be subtracted from packages, so with zypper all
+	// package updates are regular ones
+	regular := all
+	if !manager.patches {
+		regular = nil
+		for _, pkg := range all {
+			if !slices.Contains(security, pkg) {
+				regular = append(regular, pkg)
+			}
+		}
+	}
+
+	var summary string
+	var problems []string
+	data := map[string]any{"manager": manager.command, "regular": regular, "total": len(all)}
+	switch {
+	case security == nil:
+		summary = fmt.Sprintf("%s: %d updates pending (security updates cannot be told apart)", manager.command, len(all))
+	case manager.patches:
+		summary = fmt.Sprintf("%s: %d security patches and %d package updates pending", manager.command, len(security), len(all))
+	default:
+		summary = fmt.Sprintf("%s: %d security and %d other updates pending", manager.command, len(security), len(regular))
+	}
+	if security != nil {
+		data["security"] = security
+		if len(security) > maxSecurity {
+			problems = append(problems, fmt.Sprintf("%d security updates pending (limit %d): %s", len(security), maxSecurity, strings.Join(security, ", ")))
+		}
+	}
+	if maxUpdates >= 0 && len(all) > maxUpdates {
+		problems = append(problems, fmt.Sprintf("%d updates pending (limit %d)", len(all), maxUpdates))
+	}
+	return nativeResult(summary, problems, data)
+}
+
+// packageCommand runs a package manager command in the C locale and returns
+// its output; exit codes in ok other than 0 also count as success, e.g. 100
+// for "dnf check-update" with updates pending.
+func packageCommand(ctx context.Context, ok []int, name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, name, args...)
+	c.Env = append(os.Environ(), "LC_ALL=C")
+	c.Stderr = &stderr
+	out, err := c.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && slices.Contains(ok, exitErr.ExitCode()) {
+		err = nil
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", name, msg)
+		}
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	return string(out), nil
+}
+
+// aptUpdates simulates a dist-upgrade; updates from a "-security" suite
+// are security updates, e.g.
+// "Inst libssl3 [3.0.11-1] (3.0.13-1 Debian-Security:12/stable-security [amd64])".
+func aptUpdates(ctx context.Context) ([]string, []string, error) {
+	out, err := packageCommand(ctx, nil, "apt-get", "-s", "-o", "Debug::NoLocking=1", "dist-upgrade")
+	if err != nil {
+		return nil, nil, err
+	}
+	security, all := []string{}, []string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "Inst" {
+			continue
+		}
+		all = append(all, fields[1])
+		if strings.Contains(line, "-security") {
+			security = append(security, fields[1])
+		}
+	}
+	return security, all, nil
+}
+
+// yumUpdates runs check-update of dnf or yum, once for all updates and once
+// for security updates.
+func yumUpdates(ctx context.Context, command string) ([]string, []string, error) {
+	all, err := packageCommand(ctx, []int{100}, command, "-q", "check-update")
+	if err != nil {
+		return nil, nil, err
+	}
+	security, err := packageCommand(ctx, []int{100}, command, "-q", "--security", "check-update")
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseCheckUpdate(security), parseCheckUpdate(all), nil
+}
+
+// parseCheckUpdate returns the packages listed by "dnf check-update", e.g.
+// "openssl.x86_64   1:3.1.4-1.fc39   updates", leaving out obsoletes.
+func parseCheckUpdate(out string) []string {
+	packages := []string{}
+	lines := strings.Split(out, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "Obsoleting Packages") {
+			break
+		}
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		// A name too long for its column is wrapped: the version and repo
+		// follow on the next line, indented
+		fields := strings.Fields(line)
+		for len(fields) > 0 && len(fields) < 3 && i+1 < len(lines) && strings.HasPrefix(lines[i+1], " ") {
+			i++
+			fields = append(fields, strings.Fields(lines[i])...)
+		}
+		if len(fields) == 3 {
+			packages = append(packages, fields[0])
+		}
+	}
+	return packages
+}
+
+// zypperUpdates lists the package updates and the needed security patches
+// of zypper. Patches rather than packages are counted as security updates.
+func zypperUpdates(ctx context.Context) ([]string, []string, error) {
+	out, err := packageCommand(ctx, nil, "zypper", "--non-interactive", "--quiet", "list-updates")
+	if err != nil {
+		return nil, nil, err
+	}
+	all := []string{}
+	for _, row := range parseZypperTable(out) {
+		all = append(all, row["Name"])
+	}
+	out, err = packageCommand(ctx, nil, "zypper", "--non-interactive", "--quiet", "list-patches", "--category", "security")
+	if err != nil {
+		return nil, nil, err
+	}
+	security := []string{}
+	for _, row := range parseZypperTable(out) {
+		if row["Status"] == "needed" {
+			security = append(security, row["Name"])
+		}
+	}
+	return security, all, nil
+}
+
+// parseZypperTable parses the "a | b | c" tables zypper prints into rows
+// keyed by the column headers.
+func parseZypperTable(out string) []map[string]string {
+	var header []string
+	var rows []map[string]string
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, "|") || strings.Contains(line, "-+-") {
+			continue
+		}
+		cells := strings.Split(line, "|")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		if header == nil {
+			header = cells
+			continue
+		}
+		row := make(map[string]string)
+		for i, cell := range cells {
+			if i < len(header) {
+				row[header[i]] = cell
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// apkUpdates lists the upgradable packages of Alpine, whose apk does not
+// mark security updates, e.g.
+// "busybox-1.36.1-r7 x86_64 {busybox} (GPL-2.0-only) [upgradable from: busybox-1.36.1-r5]".
+func apkUpdates(ctx context.Context) ([]string, []string, error) {
+	out, err := packageCommand(ctx, nil, "apk", "-q", "list", "--upgradable")
+	if err != nil {
+		return nil, nil, err
+	}
+	all := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			all = append(all, fields[0])
+		}
+	}
+	return nil, all, nil
+}
+
+// pacmanUpdates lists the pending updates of Arch Linux with checkupdates,
+// or pacman -Qu without pacman-contrib, and the security updates with
+// arch-audit when it is installed.
+func pacmanUpdates(ctx context.Context) ([]string, []string, error) {
+	var out string
+	var err error
+	if _, lookErr := exec.LookPath("checkupdates"); lookErr == nil {
+		// checkupdates exits with 2 when there are no updates
+		out, err = packageCommand(ctx, []int{2}, "checkupdates")
+	} else {
+		// pacman -Qu exits with 1 when there are no updates
+		out, err = packageCommand(ctx, []int{1}, "pacman", "-Qu")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// e.g. "openssl 3.3.1-1 -> 3.3.2-1"
+	all := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			all = append(all, fields[0])
+		}
+	}
+
+	if _, err := exec.LookPath("arch-audit"); err != nil {
+		return nil, all, nil
+	}
+	out, err = packageCommand(ctx, nil, "arch-audit", "--upgradable", "--quiet")
+	if err != nil {
+		return nil, nil, err
+	}
+	security := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			security = append(security, fields[0])
+		}
+	}
+	return security, all, nil
+}
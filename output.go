@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Report is a completed run: the results plus metadata about the run.
+type Report struct {
+	// Random ID correlating the report with the run's log entries
+	RunID     string        `json:"run_id" yaml:"run_id"`
+	Hostname  string        `json:"hostname" yaml:"hostname"`
+	StartedAt time.Time     `json:"started_at" yaml:"started_at"`
+	Duration  float64       `json:"duration_seconds" yaml:"duration_seconds"`
+	Results   []CheckResult `json:"results" yaml:"results"`
+	// Set when a signal stopped the run, so that the results are partial
+	Interrupted bool `json:"interrupted,omitempty" yaml:"interrupted,omitempty"`
+}
+
+// runContext returns the context of a run, which ends after --timeout, on
+// SIGINT or SIGTERM, or when it is cancelled with a cause.
+func runContext() (context.Context, context.CancelCauseFunc) {
+	base, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			name := "SIGTERM"
+			if sig == os.Interrupt {
+				name = "SIGINT"
+			}
+			cancel(interruptError{name})
+		case <-base.Done():
+		}
+		signal.Stop(signals)
+	}()
+	if runTimeout > 0 {
+		ctx, stop := context.WithTimeoutCause(base, runTimeout, fmt.Errorf("Run timed out after %s", runTimeout))
+		return ctx, func(cause error) {
+			cancel(cause)
+			stop()
+		}
+	}
+	return base, cancel
+}
+
+// failFastError cancels a run when a critical check failed under
+// --fail-fast. Checks it stops are reported as Cancelled.
+type failFastError struct {
+	check string
+}
+
+func (e failFastError) Error() string {
+	return fmt.Sprintf("Cancelled by --fail-fast after %s failed", e.check)
+}
+
+// interruptError cancels a run on SIGINT or SIGTERM. Checks it stops are
+// reported as Cancelled and the report is marked as interrupted.
+type interruptError struct {
+	signal string
+}
+
+func (e interruptError) Error() string {
+	return "Cancelled by " + e.signal
+}
+
+// quitError cancels a run when the interactive view is quit while checks
+// are running. Like interruptError, the checks it stops are reported as
+// Cancelled and the report is marked as interrupted.
+type quitError struct{}
+
+func (quitError) Error() string {
+	return "Cancelled by quitting the interactive view"
+}
+
+// interrupted reports whether the run of ctx was stopped by a signal or by
+// quitting the interactive view.
+func interrupted(ctx context.Context) bool {
+	cause := context.Cause(ctx)
+	return errors.As(cause, &interruptError{}) || errors.As(cause, &quitError{})
+}
+
+// runReport runs the checks and wraps their results, followed by the
+// skipped ones, in a Report. The report is also exported as metrics, saved
+// to the report directory, sent to syslog and archived when those are
+// enabled. p is passed on to runChecks, and checks still running after
+// --timeout, or with --fail-fast after a critical check failed, are
+// cancelled.
+func runReport(checks []Check, skipped []CheckResult, p progress) *Report {
+	ctx, cancel := runContext()
+	return runReportContext(ctx, cancel, checks, skipped, p)
+}
+
+// runReportContext is runReport in a run context from runContext, for
+// callers that stop the run themselves, like the interactive view does with
+// a quitError.
+func runReportContext(ctx context.Context, cancel context.CancelCauseFunc, checks []Check, skipped []CheckResult, p progress) *Report {
+	hostname, _ := os.Hostname()
+	runID := newRunID()
+	logger := log.WithField("run_id", runID)
+	logger.Debugf("Running %d checks", len(checks))
+
+	defer cancel(nil)
+	if failFast {
+		finished := p.finished
+		p.finished = func(i int, result CheckResult) {
+			if (result.Status == statusFailed || result.Status == statusTimedOut) && result.Severity == severityCritical {
+				cancel(failFastError{result.Name})
+			}
+			if finished != nil {
+				finished(i, result)
+			}
+		}
+	}
+
+	start := time.Now()
+	results := append(runChecks(ctx, checks, logger, p), skipped...)
+	report := &Report{
+		RunID:     runID,
+		Hostname:  hostname,
+		StartedAt: start.UTC().Truncate(time.Second),
+		Duration:  time.Since(start).Round(time.Millisecond).Seconds(),
+		Results:   results,
+	}
+	report.Interrupted = interrupted(ctx)
+	logger.WithFields(logrus.Fields{
+		"passed":           countStatus(results, statusPassed),
+		"failed":           countStatus(results, statusFailed),
+		"timed_out":        countStatus(results, statusTimedOut),
+		"cancelled":        countStatus(results, statusCancelled),
+		"skipped":          countStatus(results, statusSkipped),
+		"duration_seconds": report.Duration,
+	}).Debug("Run finished")
+
+	exportMetrics(report)
+	saveReport(report)
+	sendSyslog(report)
+	saveArchive(checks, report)
+	return report
+}
+
+// newRunID returns a random 16 hex digit run ID.
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Formats accepted by --output
+var outputFormats = []string{"json", "yaml", "csv", "tsv", "markdown", "junit", "sarif", "prometheus", "template", "summary"}
+
+// writeReport writes a report in the given format. JSON is the bare results
+// array, as it always has been; the other formats include run metadata.
+func writeReport(w io.Writer, format string, report *Report) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report.Results)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "csv":
+		return writeDelimited(w, ',', report.Results)
+	case "tsv":
+		return writeDelimited(w, '\t', report.Results)
+	case "markdown":
+		return writeMarkdown(w, report)
+	case "junit":
+		return writeJUnit(w, report)
+	case "sarif":
+		return writeSARIF(w, report)
+	case "prometheus":
+		return writeMetrics(w, report)
+	case "template":
+		return writeTemplate(w, templatePath, report)
+	case "summary":
+		return writeSummary(w, report)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeDelimited writes one row per check with a header row, for
+// spreadsheets and BI pipelines.
+func writeDelimited(w io.Writer, comma rune, results []CheckResult) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.Write([]string{"name", "status", "severity", "duration_seconds", "message"})
+	for _, r := range results {
+		cw.Write([]string{r.Name, r.Status, r.Severity, strconv.FormatFloat(r.Duration, 'f', 3, 64), r.Message})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeMarkdown writes a summary table followed by the output of every
+// failed or timed out check, for pasting into issues and wikis.
+func writeMarkdown(w io.Writer, report *Report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# System Check Results\n\n")
+	fmt.Fprintf(&b, "**Host:** %s  \n**Started:** %s  \n**Duration:** %.2fs\n\n",
+		report.Hostname, report.StartedAt.Format(time.RFC3339), report.Duration)
+
+	var counts []string
+	for _, status := range reportStatuses {
+		if n := countStatus(report.Results, status); n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+	fmt.Fprintf(&b, "%s\n\n", strings.Join(counts, " · "))
+
+	b.WriteString("| Status | Check | Severity | Duration |\n")
+	b.WriteString("|--------|-------|----------|---------:|\n")
+	var failed []CheckResult
+	for _, r := range report.Results {
+		fmt.Fprintf(&b, "| %s %s | %s | %s | %.2fs |\n",
+			markdownStatusIcons[r.Status], r.Status, escapeMarkdownCell(r.Name), r.Severity, r.Duration)
+		if r.Status == statusFailed || r.Status == statusTimedOut {
+			failed = append(failed, r)
+		}
+	}
+
+	if len(failed) > 0 {
+		b.WriteString("\n## Failed Checks\n")
+		for _, r := range failed {
+			fence := "```"
+			for strings.Contains(r.Message, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "\n### %s\n\n%stext\n%s\n%s\n", r.Name, fence, r.Message, fence)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var markdownStatusIcons = map[string]string{
+	statusPassed:    "✅",
+	statusFailed:    "❌",
+	statusTimedOut:  "⏱️",
+	statusCancelled: "🛑",
+	statusSkipped:   "⏭️",
+}
+
+func escapeMarkdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Hostname  string          `xml:"hostname,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitProblem `xml:"skipped,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnit writes the report as a JUnit XML test suite with one test case
+// per check, so CI servers can render runs natively. Failed checks become
+// failures carrying the error hint and output, timeouts become errors.
+func writeJUnit(w io.Writer, report *Report) error {
+	suite := junitTestSuite{
+		Name:      "kumo",
+		Hostname:  report.Hostname,
+		Timestamp: report.StartedAt.Format("2006-01-02T15:04:05"),
+		Tests:     len(report.Results),
+		Time:      strconv.FormatFloat(report.Duration, 'f', 3, 64),
+	}
+	for _, r := range report.Results {
+		tc := junitTestCase{
+			Name:      r.Name,
+			ClassName: "kumo." + r.Severity,
+			Time:      strconv.FormatFloat(r.Duration, 'f', 3, 64),
+		}
+		// The hint is the part of the message before the captured output
+		hint, _, _ := strings.Cut(r.Message, " (")
+		switch r.Status {
+		case statusFailed:
+			suite.Failures++
+			tc.Failure = &junitProblem{Message: hint, Type: r.Severity, Body: r.Message}
+		case statusTimedOut:
+			suite.Errors++
+			tc.Error = &junitProblem{Message: r.Message, Type: statusTimedOut}
+		case statusSkipped, statusCancelled:
+			suite.Skipped++
+			tc.Skipped = &junitProblem{Message: strings.TrimPrefix(r.Message, "Skipped: ")}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeSummary writes the status counts, total duration and the names of
+// the checks that did not pass, short enough for a MOTD banner.
+func writeSummary(w io.Writer, report *Report) error {
+	var counts, failed []string
+	for _, status := range reportStatuses {
+		if n := countStatus(report.Results, status); n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, strings.ToLower(status)))
+		}
+	}
+	for _, r := range report.Results {
+		if r.Status == statusFailed || r.Status == statusTimedOut {
+			failed = append(failed, r.Name)
+		}
+	}
+
+	noun := "checks"
+	if len(report.Results) == 1 {
+		noun = "check"
+	}
+	fmt.Fprintf(w, "kumo: %d %s, %s in %.2fs\n", len(report.Results), noun, strings.Join(counts, ", "), report.Duration)
+	if len(failed) > 0 {
+		fmt.Fprintf(w, "Failed: %s\n", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Functions available to --template files, on top of the built-ins
+var reportTemplateFuncs = template.FuncMap{
+	"count": func(status string, results []CheckResult) int { return countStatus(results, status) },
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// writeTemplate renders the report through a user-supplied text/template.
+// The template sees the Report, e.g. {{ .Hostname }} and
+// {{ range .Results }}{{ .Name }}: {{ .Status }}{{ end }}.
+func writeTemplate(w io.Writer, path string, report *Report) error {
+	if path == "" {
+		return fmt.Errorf("--output template needs --template FILE")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(reportTemplateFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, report)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strings"
+)
+
+// Reason privileged checks are skipped for when kumo is not root
+const needsRootReason = "needs root (run kumo as root or with --sudo)"
+
+// selectPrivileged skips the privileged checks, and those to run as another
+// user, when kumo is not running as root. With --sudo, their commands run
+// through sudo instead; native checks run inside kumo and are skipped either
+// way.
+func selectPrivileged(checks []Check) ([]Check, []CheckResult) {
+	if isRoot() {
+		return checks, nil
+	}
+
+	selected := make([]Check, 0, len(checks))
+	var skipped []CheckResult
+	for _, check := range checks {
+		if check.Privileged && (!useSudo || check.Native != "") {
+			skipped = append(skipped, skippedResult(check, needsRootReason))
+			continue
+		}
+		if check.User != "" && !useSudo && !isCurrentUser(check.User) {
+			skipped = append(skipped, skippedResult(check, fmt.Sprintf("needs root to run as %s (run kumo as root or with --sudo)", check.User)))
+			continue
+		}
+		selected = append(selected, check)
+	}
+	return selected, skipped
+}
+
+// shellCommand builds the command running the check's cmd through its
+// shell in its dir, with the secrets given as KEY=VALUE added to its
+// environment. Privileged commands run as root and those with a user as
+// that user, through sudo when kumo is not root itself. When kumo was
+// started with sudo, the others run as the invoking user. Sandboxed
+// commands are left to sandboxCommand.
+func shellCommand(ctx context.Context, check Check, secrets []string) (*exec.Cmd, error) {
+	argv, err := check.argv()
+	if err != nil {
+		return nil, err
+	}
+	if check.sandboxed() {
+		return sandboxCommand(ctx, check, argv, secrets)
+	}
+	if argv, err = check.Limits.wrap(argv); err != nil {
+		return nil, err
+	}
+	var c *exec.Cmd
+	root := isRoot()
+	switch {
+	case !root && (check.Privileged || check.User != "" && !isCurrentUser(check.User)):
+		c = sudoCommand(ctx, check.User, check.envNames(secrets), argv)
+		c.Env = check.environ(secrets)
+	case root && check.User != "":
+		u, err := lookupUser(check.User)
+		if err != nil {
+			return nil, err
+		}
+		c = exec.CommandContext(ctx, argv[0], argv[1:]...)
+		c.Env = check.environ(secrets)
+		if err := runAs(c, u); err != nil {
+			return nil, err
+		}
+	default:
+		c = exec.CommandContext(ctx, argv[0], argv[1:]...)
+		c.Env = check.environ(secrets)
+		if root && !check.Privileged {
+			runAsInvokingUser(c)
+		}
+	}
+	c.Dir = check.Dir
+	return c, nil
+}
+
+// sudoCommand builds the command running argv through sudo -n, as user or
+// else root. sudo resets the environment, so the variables named by keep
+// are preserved explicitly.
+func sudoCommand(ctx context.Context, user string, keep []string, argv []string) *exec.Cmd {
+	args := []string{"-n"}
+	if user != "" {
+		args = append(args, "-u", user)
+	}
+	if len(keep) > 0 {
+		args = append(args, "--preserve-env="+strings.Join(keep, ","))
+	}
+	args = append(append(args, "--"), argv...)
+	return exec.CommandContext(ctx, "sudo", args...)
+}
+
+// lookupUser finds a user by name or numeric ID.
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if byID, idErr := user.LookupId(name); idErr == nil {
+			return byID, nil
+		}
+	}
+	return u, err
+}
+
+// isCurrentUser reports whether name is the user kumo runs as.
+func isCurrentUser(name string) bool {
+	current, err := user.Current()
+	return err == nil && (name == current.Username || name == current.Uid)
+}
@@ -0,0 +1,29 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+)
+
+func isRoot() bool {
+	return false
+}
+
+func runAsInvokingUser(c *exec.Cmd) {}
+
+func runAs(c *exec.Cmd, u *user.User) error {
+	return fmt.Errorf("running checks as another user is not supported on %s", runtime.GOOS)
+}
+
+func fileOwner(fi os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
+
+func fileDevice(fi os.FileInfo) (dev uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,71 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// isRoot reports whether kumo may run privileged checks itself.
+func isRoot() bool {
+	return os.Geteuid() == 0
+}
+
+// runAsInvokingUser makes c run as the user who started kumo through sudo,
+// going by SUDO_UID. Without such a user c is left to run as root.
+func runAsInvokingUser(c *exec.Cmd) {
+	uid := os.Getenv("SUDO_UID")
+	if uid == "" || uid == "0" {
+		return
+	}
+	if u, err := user.LookupId(uid); err == nil {
+		runAs(c, u)
+	}
+}
+
+// runAs makes c, started by root, run as u with u's groups, and sets its
+// home directory and name in c.Env.
+func runAs(c *exec.Cmd, u *user.User) error {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return err
+	}
+	var groups []uint32
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+
+	c.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}}
+	c.Env = append(c.Env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	return nil
+}
+
+// fileOwner returns the UID and GID owning the file fi describes.
+func fileOwner(fi os.FileInfo) (uid, gid uint32, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return st.Uid, st.Gid, true
+}
+
+// fileDevice returns the ID of the device holding the file fi describes.
+func fileDevice(fi os.FileInfo) (dev uint64, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
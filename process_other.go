@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killProcessGroup leaves c to be killed by itself when it is cancelled.
+func killProcessGroup(c *exec.Cmd) {}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup starts c in a process group of its own and makes
+// cancelling it kill the whole group, so that the other commands of a
+// pipeline like `apt update | grep` and anything else the shell started do
+// not outlive a timeout.
+func killProcessGroup(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+	c.Cancel = func() error {
+		// The group is gone if the command exited, or may belong to root
+		// for commands run through sudo; fall back to the command itself
+		if err := syscall.Kill(-c.Process.Pid, syscall.SIGKILL); err != nil {
+			return c.Process.Kill()
+		}
+		return nil
+	}
+}
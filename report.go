@@ -0,0 +1,128 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+)
+
+//go:embed templates/report.html
+var htmlReportTemplate string
+
+var htmlReport = template.Must(template.New("report").Parse(htmlReportTemplate))
+
+// Order of the status counts in report summaries
+var reportStatuses = []string{statusPassed, statusFailed, statusTimedOut, statusCancelled, statusSkipped}
+
+// runReportCommand implements "kumo report": it runs the checks and writes
+// the results to a report file rather than the terminal.
+func runReportCommand(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	htmlPath := fs.String("html", "", "write a self-contained HTML report to this file")
+	jsonPath := fs.String("json", "", "write a JSON report with run metadata to this file")
+	fs.StringVar(&signKeyPath, "sign-key", "", "minisign secret key; each report gets a detached FILE.minisig signature (password from "+signPasswordEnv+")")
+	registerRunFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: kumo report [--html FILE] [--json FILE] [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *htmlPath == "" && *jsonPath == "" {
+		fs.Usage()
+		return 2
+	}
+	if err := loadSigningKey(); err != nil {
+		log.Fatal(err)
+	}
+
+	checks, skipped, err := prepareChecks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	report := runReport(checks, skipped, progress{})
+
+	if *htmlPath != "" {
+		writeReportFile(*htmlPath, func(w io.Writer) error { return writeHTMLReport(w, report) })
+	}
+	if *jsonPath != "" {
+		writeReportFile(*jsonPath, func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		})
+	}
+	return report.exitCode()
+}
+
+// writeReportFile writes a report file with write and signs it when a
+// signing key is loaded.
+func writeReportFile(path string, write func(io.Writer) error) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Error writing report: %v", err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		log.Fatalf("Error writing report: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Error writing report: %v", err)
+	}
+	if err := signReport(path); err != nil {
+		log.Fatalf("Error signing report: %v", err)
+	}
+	log.Infof("Report written to %s", path)
+}
+
+// writeHTMLReport renders a report as a single HTML page with a status
+// summary, collapsible output per check and relative timing bars.
+func writeHTMLReport(w io.Writer, report *Report) error {
+	type row struct {
+		CheckResult
+		BarPercent float64
+	}
+	type count struct {
+		Status string
+		Count  int
+	}
+
+	longest := 0.0
+	for _, r := range report.Results {
+		longest = max(longest, r.Duration)
+	}
+	rows := make([]row, len(report.Results))
+	for i, r := range report.Results {
+		rows[i] = row{CheckResult: r}
+		if longest > 0 {
+			rows[i].BarPercent = r.Duration / longest * 100
+		}
+	}
+
+	var counts []count
+	for _, status := range reportStatuses {
+		if n := countStatus(report.Results, status); n > 0 {
+			counts = append(counts, count{status, n})
+		}
+	}
+
+	return htmlReport.Execute(w, struct {
+		*Report
+		Rows   []row
+		Counts []count
+	}{report, rows, counts})
+}
+
+func countStatus(results []CheckResult, status string) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// File extensions for the report formats
+var reportExtensions = map[string]string{
+	"json":       ".json",
+	"yaml":       ".yaml",
+	"csv":        ".csv",
+	"tsv":        ".tsv",
+	"markdown":   ".md",
+	"junit":      ".xml",
+	"sarif":      ".sarif",
+	"prometheus": ".prom",
+	"template":   ".txt",
+}
+
+const reportFilePrefix = "kumo-"
+
+// saveReport writes the report to --report-dir as kumo-<timestamp>.<ext>
+// and prunes old reports. Failures are logged rather than aborting the run.
+func saveReport(report *Report) {
+	if reportDir == "" {
+		return
+	}
+	if err := os.MkdirAll(reportDir, 0o755); err != nil {
+		log.Errorf("Error saving report: %v", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, reportFormat, report); err != nil {
+		log.Errorf("Error saving report: %v", err)
+		return
+	}
+	ext := reportExtensions[reportFormat]
+	name := filepath.Join(reportDir, reportFilePrefix+report.StartedAt.UTC().Format("20060102T150405Z")+ext)
+	if err := writeFileAtomic(name, buf.Bytes(), 0o640); err != nil {
+		log.Errorf("Error saving report: %v", err)
+		return
+	}
+	if err := signReport(name); err != nil {
+		log.Errorf("Error signing report: %v", err)
+	}
+
+	if err := pruneReports(reportDir, ext, reportKeep, reportMaxAge, time.Now()); err != nil {
+		log.Warnf("Error pruning old reports: %v", err)
+	}
+}
+
+// pruneReports removes the kumo reports with the given extension in dir
+// beyond the newest keep, and those older than maxAge. Zero disables either
+// limit.
+func pruneReports(dir, ext string, keep int, maxAge time.Duration, now time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, reportFilePrefix) && strings.HasSuffix(name, ext) {
+			names = append(names, name)
+		}
+	}
+	// Timestamped names sort oldest first
+	slices.Sort(names)
+
+	var errs []error
+	for i, name := range names {
+		expired := keep > 0 && i < len(names)-keep
+		if !expired && maxAge > 0 {
+			stamp := strings.TrimSuffix(strings.TrimPrefix(name, reportFilePrefix), ext)
+			if t, err := time.Parse("20060102T150405Z", stamp); err == nil && now.Sub(t) > maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				errs = append(errs, err)
+			}
+			// The signature goes with its report
+			if err := os.Remove(filepath.Join(dir, name+signatureSuffix)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
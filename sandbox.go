@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// Hardening of sandboxed commands: a read-only filesystem with a private
+// /tmp, no devices, kernel settings or privilege escalation, and a seccomp
+// filter allowing the system calls of ordinary services. Root keeps only
+// the capability to read any file.
+var sandboxProperties = []string{
+	"ProtectSystem=strict",
+	"ProtectHome=read-only",
+	"PrivateTmp=yes",
+	"PrivateDevices=yes",
+	"NoNewPrivileges=yes",
+	"ProtectKernelTunables=yes",
+	"ProtectKernelModules=yes",
+	"ProtectKernelLogs=yes",
+	"ProtectControlGroups=yes",
+	"ProtectClock=yes",
+	"ProtectHostname=yes",
+	"RestrictSUIDSGID=yes",
+	"RestrictNamespaces=yes",
+	"RestrictRealtime=yes",
+	"LockPersonality=yes",
+	"RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6 AF_NETLINK",
+	"SystemCallFilter=@system-service",
+	"SystemCallErrorNumber=EPERM",
+	"CapabilityBoundingSet=CAP_DAC_READ_SEARCH",
+}
+
+// sandboxed reports whether the check's cmd runs in the sandbox: when
+// --sandbox is set, unless the check opts out with sandbox: false, or when
+// the check asks for it itself.
+func (c Check) sandboxed() bool {
+	if c.Sandbox != nil {
+		return *c.Sandbox
+	}
+	return useSandbox
+}
+
+// sandboxCommand builds the command running argv as a transient systemd
+// unit with sandboxProperties, in the system manager for privileged checks
+// and those run as another user, and in the user's own manager otherwise.
+// The unit starts from the manager's environment; only the check's env and
+// the secrets are passed on. Its limits are enforced by systemd.
+func sandboxCommand(ctx context.Context, check Check, argv []string, secrets []string) (*exec.Cmd, error) {
+	if _, err := exec.LookPath("systemd-run"); err != nil {
+		return nil, fmt.Errorf("the sandbox needs systemd-run: %w", err)
+	}
+
+	root := isRoot()
+	system := root || check.Privileged || check.User != "" && !isCurrentUser(check.User)
+	args := []string{"--quiet", "--pipe", "--wait", "--collect"}
+	switch {
+	case !system:
+		args = append(args, "--user")
+	case check.User != "":
+		args = append(args, "--uid="+check.User)
+	case root && !check.Privileged:
+		if uid := os.Getenv("SUDO_UID"); uid != "" && uid != "0" {
+			args = append(args, "--uid="+uid)
+		}
+	}
+	if check.Dir != "" {
+		dir, err := filepath.Abs(check.Dir)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--working-directory="+dir)
+	} else {
+		args = append(args, "--same-dir")
+	}
+	if check.Timeout > 0 {
+		// Stops the unit even if systemd-run itself is killed first
+		args = append(args, fmt.Sprintf("--property=RuntimeMaxSec=%gs", check.Timeout.Seconds()))
+	}
+	for _, property := range slices.Concat(sandboxProperties, check.Limits.properties()) {
+		args = append(args, "--property="+property)
+	}
+	names := check.envNames(secrets)
+	for _, name := range names {
+		args = append(args, "--setenv="+name)
+	}
+	args = append(append(args, "--"), argv...)
+
+	argv = append([]string{"systemd-run"}, args...)
+	var c *exec.Cmd
+	if !root && system {
+		// systemd-run itself needs root; the unit's user is set by --uid
+		c = sudoCommand(ctx, "", names, argv)
+	} else {
+		c = exec.CommandContext(ctx, argv[0], argv[1:]...)
+	}
+	c.Env = check.environ(secrets)
+	return c, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const sarifSchema = "https://docs.oasis-open.org/sarif/sarif/v2.1.0/errata01/os/schemas/sarif-schema-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	Help                 *sarifMessage      `json:"help,omitempty"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           sarifProperties    `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifProperties struct {
+	// Read by GitHub code scanning to rank security findings
+	SecuritySeverity string `json:"security-severity"`
+	// The check's compliance controls
+	Tags []string `json:"tags,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// SARIF levels and GitHub security-severity scores for each check severity
+var sarifLevels = map[string]string{
+	severityInfo:     "note",
+	severityWarning:  "warning",
+	severityCritical: "error",
+}
+
+var sarifSecuritySeverities = map[string]string{
+	severityInfo:     "2.0",
+	severityWarning:  "5.0",
+	severityCritical: "9.0",
+}
+
+// writeSARIF writes the report as a SARIF 2.1 log. Every check that ran is
+// a rule and every failed or timed out one a result located on the host, so
+// findings show up in GitHub code scanning and other SARIF consumers.
+func writeSARIF(w io.Writer, report *Report) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "kumo",
+			InformationURI: "https://github.com/kintsdev/kumo",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	for _, r := range report.Results {
+		if r.Status == statusSkipped || r.Status == statusCancelled {
+			continue
+		}
+		hint, _, _ := strings.Cut(r.Message, " (")
+		rule := sarifRule{
+			ID:                   sarifRuleID(r.Name),
+			Name:                 r.Name,
+			ShortDescription:     sarifMessage{Text: r.Name},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevels[r.Severity]},
+			Properties:           sarifProperties{SecuritySeverity: sarifSecuritySeverities[r.Severity], Tags: r.Controls},
+		}
+		if r.Remediation != "" {
+			rule.Help = &sarifMessage{Text: r.Remediation}
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+
+		if r.Status == statusPassed {
+			continue
+		}
+		if r.Status == statusTimedOut || hint == "" {
+			hint = r.Message
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    rule.ID,
+			RuleIndex: len(run.Tool.Driver.Rules) - 1,
+			Level:     rule.DefaultConfiguration.Level,
+			Message:   sarifMessage{Text: hint},
+			Locations: []sarifLocation{{LogicalLocations: []sarifLogicalLocation{{Name: report.Hostname, Kind: "host"}}}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
+
+// sarifRuleID turns a check name into a stable rule ID, e.g. "SSH Security"
+// becomes "kumo/ssh-security".
+func sarifRuleID(name string) string {
+	return "kumo/" + slugify(name)
+}
+
+// slugify lowercases name and joins its words with dashes.
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// progress is told about the checks of a run by their index: when one
+// starts executing, after any dependencies, and when it has finished or been
+// skipped. Either func may be nil.
+type progress struct {
+	started  func(i int)
+	finished func(i int, result CheckResult)
+}
+
+// runChecks runs the checks concurrently, at most --concurrency at a time
+// and those with a higher priority first, except that a check with
+// dependencies waits for them to finish, without taking up one of the
+// slots, and only runs if all of them passed. Otherwise it is reported as
+// Skipped. Dependencies must be acyclic (see findCycle); a dependency
+// outside the given set also skips the check.
+// A check with a cache_ttl reuses its cached result while that is fresh.
+// Results are returned in the order of checks and each is logged at debug
+// level with the run's fields, and reported to p as they start and finish.
+// Once ctx is done, commands still running are killed and reported as
+// TimedOut, or Cancelled after a signal or --fail-fast, and so are checks
+// that would only have started afterwards, without being started.
+// With --sequential the checks run one at a time in config order, each
+// after the checks it depends on.
+func runChecks(ctx context.Context, checks []Check, logger *logrus.Entry, p progress) []CheckResult {
+	var wg sync.WaitGroup
+	results := make([]CheckResult, len(checks))
+	mutex := &sync.Mutex{}
+
+	done := make(map[string]chan struct{}, len(checks))
+	for _, check := range checks {
+		done[check.Name] = make(chan struct{})
+	}
+	statuses := make(map[string]string, len(checks))
+	// Held while a command runs, so at most --concurrency run at once
+	slots := newSlotQueue(concurrency)
+
+	// Checks without dependencies queue up front, so that the first slots
+	// go to the highest priority ones rather than whichever starts first
+	cachedResults := make([]*CheckResult, len(checks))
+	tickets := make([]*slotTicket, len(checks))
+	for i, check := range checks {
+		// A cached result was stored after its dependencies had passed
+		if result, cached := loadCachedResult(check); cached {
+			cachedResults[i] = &result
+		} else if len(check.DependsOn) == 0 && !sequential {
+			tickets[i] = slots.add(check.priorityRank(), i)
+		}
+	}
+	slots.start()
+
+	run := func(i int, check Check) {
+		defer close(done[check.Name])
+
+		var result CheckResult
+		if cachedResults[i] != nil {
+			result = *cachedResults[i]
+		} else if reason := awaitDependencies(check, done, statuses, mutex); reason != "" {
+			result = skippedResult(check, reason)
+		} else {
+			ticket := tickets[i]
+			if ticket == nil {
+				ticket = slots.add(check.priorityRank(), i)
+			}
+			if slots.wait(ctx, ticket) {
+				defer slots.release()
+				if p.started != nil {
+					p.started(i)
+				}
+				result = executeCheck(ctx, check)
+				storeCachedResult(check, result)
+			} else {
+				result = notStartedResult(ctx, check)
+			}
+		}
+		logger.WithFields(logrus.Fields{
+			"check":            result.Name,
+			"status":           result.Status,
+			"severity":         result.Severity,
+			"duration_seconds": result.Duration,
+		}).Debug(result.Message)
+
+		mutex.Lock()
+		results[i] = result
+		statuses[check.Name] = result.Status
+		mutex.Unlock()
+		if p.finished != nil {
+			p.finished(i, result)
+		}
+	}
+
+	if sequential {
+		// The slot is always free here: a released slot would otherwise go
+		// to whichever check queues first, not to the next one in order
+		index := make(map[string]int, len(checks))
+		for i, check := range checks {
+			index[check.Name] = i
+		}
+		ran := make([]bool, len(checks))
+		var visit func(i int)
+		visit = func(i int) {
+			if ran[i] {
+				return
+			}
+			ran[i] = true
+			for _, dep := range checks[i].DependsOn {
+				if j, ok := index[dep]; ok {
+					visit(j)
+				}
+			}
+			run(i, checks[i])
+		}
+		for i := range checks {
+			visit(i)
+		}
+		return results
+	}
+
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(i, check)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// notStartedResult reports a check still queued for a slot when the run's
+// ctx ended, by the cause of that.
+func notStartedResult(ctx context.Context, check Check) CheckResult {
+	return CheckResult{
+		Name:     check.Name,
+		Status:   runEndedStatus(ctx),
+		Severity: check.severity(),
+		Message:  context.Cause(ctx).Error(),
+		Controls: check.Controls,
+	}
+}
+
+// awaitDependencies blocks until all dependencies of check have finished and
+// returns why the check must be skipped, or "" if it may run.
+func awaitDependencies(check Check, done map[string]chan struct{}, statuses map[string]string, mutex *sync.Mutex) string {
+	for _, dep := range check.DependsOn {
+		ch, ok := done[dep]
+		if !ok {
+			return fmt.Sprintf("dependency %q is not selected", dep)
+		}
+		<-ch
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, dep := range check.DependsOn {
+		if status := statuses[dep]; status != statusPassed {
+			return fmt.Sprintf("dependency %q is %s", dep, status)
+		}
+	}
+	return ""
+}
+
+// findCycle returns the names forming a dependency cycle, first name
+// repeated at the end, or nil if the dependency graph is acyclic. Unknown
+// dependencies are ignored.
+func findCycle(checks []Check) []string {
+	deps := make(map[string][]string, len(checks))
+	for _, check := range checks {
+		deps[check.Name] = check.DependsOn
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(checks))
+	var stack []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, n := range stack {
+				if n == name {
+					return append(append([]string{}, stack[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range deps[name] {
+			if _, ok := deps[dep]; !ok {
+				continue
+			}
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, check := range checks {
+		if cycle := visit(check.Name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+func formatCycle(cycle []string) string {
+	return strings.Join(cycle, " -> ")
+}
+
+// slotQueue hands out the --concurrency slots of a run to the waiting checks
+// by priority, and in config order among checks of the same priority.
+type slotQueue struct {
+	mu      sync.Mutex
+	free    int
+	started bool
+	waiting []*slotTicket
+}
+
+// slotTicket is a check's place in the slotQueue.
+type slotTicket struct {
+	rank, index int
+	granted     chan struct{}
+}
+
+func newSlotQueue(size int) *slotQueue {
+	return &slotQueue{free: size}
+}
+
+// add queues a check with the given priority rank and index for a slot.
+func (q *slotQueue) add(rank, index int) *slotTicket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := &slotTicket{rank: rank, index: index, granted: make(chan struct{})}
+	q.waiting = append(q.waiting, t)
+	q.grant()
+	return t
+}
+
+// start begins handing out slots, once the checks that can run right away
+// have all been added.
+func (q *slotQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.started = true
+	q.grant()
+}
+
+// wait blocks until t is granted a slot and reports true, or false if ctx
+// is done first.
+func (q *slotQueue) wait(ctx context.Context, t *slotTicket) bool {
+	select {
+	case <-t.granted:
+		return true
+	case <-ctx.Done():
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := slices.Index(q.waiting, t); i >= 0 {
+		q.waiting = slices.Delete(q.waiting, i, i+1)
+		return false
+	}
+	// Granted just as ctx was done; the caller releases the slot
+	return true
+}
+
+// release returns a slot that wait granted.
+func (q *slotQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.free++
+	q.grant()
+}
+
+// grant hands the free slots to the best waiting tickets; q.mu is held.
+func (q *slotQueue) grant() {
+	for q.started && q.free > 0 && len(q.waiting) > 0 {
+		best := 0
+		for i, t := range q.waiting {
+			if b := q.waiting[best]; t.rank < b.rank || t.rank == b.rank && t.index < b.index {
+				best = i
+			}
+		}
+		close(q.waiting[best].granted)
+		q.waiting = slices.Delete(q.waiting, best, best+1)
+		q.free--
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SecretSpec says where a secret comes from. Key is the variable name for
+// the env provider, the file path for the file provider and "path#field"
+// for the vault provider, e.g. "secret/data/db#password".
+type SecretSpec struct {
+	Provider string `yaml:"provider" toml:"provider"`
+	Key      string `yaml:"key" toml:"key"`
+}
+
+// secretProvider fetches the value of a secret by key.
+type secretProvider interface {
+	fetch(key string) (string, error)
+}
+
+var secretProviders = map[string]secretProvider{
+	"env":   envSecrets{},
+	"file":  fileSecrets{},
+	"vault": vaultSecrets{},
+}
+
+func (s SecretSpec) validate() error {
+	if _, ok := secretProviders[s.Provider]; !ok {
+		return fmt.Errorf("unknown provider %q (use env, file or vault)", s.Provider)
+	}
+	if s.Key == "" {
+		return fmt.Errorf("missing key")
+	}
+	if s.Provider == "vault" && !strings.Contains(s.Key, "#") {
+		return fmt.Errorf("vault key must be path#field, got %q", s.Key)
+	}
+	return nil
+}
+
+// Redacted secret values are replaced with this
+const redactedSecret = "********"
+
+// secretCache holds every secret fetched so far, so each is fetched once per
+// run and all of them can be redacted from output.
+var secretCache = struct {
+	sync.Mutex
+	values map[SecretSpec]string
+}{values: make(map[SecretSpec]string)}
+
+// resolveSecret returns the value of a secret, fetching it on first use.
+func resolveSecret(spec SecretSpec) (string, error) {
+	secretCache.Lock()
+	defer secretCache.Unlock()
+	if v, ok := secretCache.values[spec]; ok {
+		return v, nil
+	}
+	v, err := secretProviders[spec.Provider].fetch(spec.Key)
+	if err != nil {
+		return "", err
+	}
+	secretCache.values[spec] = v
+	return v, nil
+}
+
+// secretEnv resolves the secrets a check uses into NAME=value pairs for its
+// command's environment.
+func secretEnv(check Check) ([]string, error) {
+	names := make([]string, 0, len(check.secretSpecs))
+	for name := range check.secretSpecs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		v, err := resolveSecret(check.secretSpecs[name])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", name, err)
+		}
+		env = append(env, name+"="+v)
+	}
+	return env, nil
+}
+
+// redactSecrets replaces every secret value fetched so far in s.
+func redactSecrets(s string) string {
+	secretCache.Lock()
+	defer secretCache.Unlock()
+	for _, v := range secretCache.values {
+		if v != "" {
+			s = strings.ReplaceAll(s, v, redactedSecret)
+		}
+	}
+	return s
+}
+
+// longestSecret returns the length of the longest secret value fetched so
+// far.
+func longestSecret() int {
+	secretCache.Lock()
+	defer secretCache.Unlock()
+	n := 0
+	for _, v := range secretCache.values {
+		n = max(n, len(v))
+	}
+	return n
+}
+
+// redactHook scrubs secret values from log messages and fields.
+type redactHook struct{}
+
+func (redactHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = redactSecrets(entry.Message)
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			entry.Data[k] = redactSecrets(s)
+		}
+	}
+	return nil
+}
+
+type envSecrets struct{}
+
+func (envSecrets) fetch(key string) (string, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", key)
+	}
+	return v, nil
+}
+
+type fileSecrets struct{}
+
+func (fileSecrets) fetch(key string) (string, error) {
+	data, err := os.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// vaultSecrets reads from HashiCorp Vault's HTTP API using VAULT_ADDR and
+// VAULT_TOKEN (or ~/.vault-token). Both KV v1 and v2 responses are handled.
+type vaultSecrets struct{}
+
+func (vaultSecrets) fetch(key string) (string, error) {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		data, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+		if err != nil {
+			return "", fmt.Errorf("VAULT_TOKEN is not set and ~/.vault-token is unreadable")
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	path, field, _ := strings.Cut(key, "#")
+	req, err := http.NewRequest(http.MethodGet, addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: %s: unexpected status %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault: %s: %w", path, err)
+	}
+	data := body.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no field %q", path, field)
+	}
+	return fmt.Sprint(v), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// listFlag is a repeatable flag whose values may also be comma-separated,
+// so "--profile a,b" and "--profile a --profile b" are equivalent.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// defineFlag collects repeatable "-D key=value" flags.
+type defineFlag map[string]string
+
+func (d defineFlag) String() string {
+	pairs := make([]string, 0, len(d))
+	for k, v := range d {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (d defineFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	d[strings.TrimSpace(key)] = val
+	return nil
+}
+
+// selectProfiles keeps the checks that belong to at least one of the given
+// profiles. An empty profile list selects every check.
+func selectProfiles(checks []Check, profiles []string) ([]Check, error) {
+	if len(profiles) == 0 {
+		return checks, nil
+	}
+
+	known := make(map[string]bool)
+	for _, check := range checks {
+		for _, p := range check.Profiles {
+			known[p] = true
+		}
+	}
+	for _, p := range profiles {
+		if !known[p] {
+			return nil, fmt.Errorf("unknown profile %q", p)
+		}
+	}
+
+	selected := make([]Check, 0, len(checks))
+	for _, check := range checks {
+		if _, ok := firstCommon(check.Profiles, profiles); ok {
+			selected = append(selected, check)
+		}
+	}
+	return selected, nil
+}
+
+// selectTags filters checks by tag. With a non-empty include list only checks
+// carrying one of those tags run; checks carrying any skip tag never run.
+// Filtered-out checks are returned as Skipped results so they still show up
+// in the report.
+func selectTags(checks []Check, include, skip []string) ([]Check, []CheckResult) {
+	if len(include) == 0 && len(skip) == 0 {
+		return checks, nil
+	}
+
+	selected := make([]Check, 0, len(checks))
+	var skipped []CheckResult
+	for _, check := range checks {
+		if tag, ok := firstCommon(check.Tags, skip); ok {
+			skipped = append(skipped, skippedResult(check, fmt.Sprintf("tag %q is skipped", tag)))
+			continue
+		}
+		if _, ok := firstCommon(check.Tags, include); len(include) > 0 && !ok {
+			skipped = append(skipped, skippedResult(check, "no tag matched --tags"))
+			continue
+		}
+		selected = append(selected, check)
+	}
+	return selected, skipped
+}
+
+func firstCommon(values, candidates []string) (string, bool) {
+	for _, v := range values {
+		if slices.Contains(candidates, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func skippedResult(check Check, reason string) CheckResult {
+	return CheckResult{
+		Name:     check.Name,
+		Status:   statusSkipped,
+		Severity: check.severity(),
+		Message:  "Skipped: " + reason,
+		Controls: check.Controls,
+	}
+}
+
+// selectNames filters checks by name using shell glob patterns: with a
+// non-empty only list a check must match one of them, and any check matching
+// an exclude pattern is dropped.
+func selectNames(checks []Check, only, exclude []string) ([]Check, error) {
+	for _, pattern := range append(slices.Clip(only), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+	}
+
+	selected := make([]Check, 0, len(checks))
+	for _, check := range checks {
+		if len(only) > 0 && !matchesAny(check.Name, only) {
+			continue
+		}
+		if matchesAny(check.Name, exclude) {
+			continue
+		}
+		selected = append(selected, check)
+	}
+	return selected, nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Values of a check's shell
+var checkShells = []string{"bash", "sh", "powershell", "cmd", "none"}
+
+// defaultShell returns the shell of checks that don't set one: PowerShell
+// on Windows, sh on the BSDs, which do not ship bash, and bash elsewhere.
+func defaultShell() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "powershell"
+	case "freebsd", "openbsd":
+		return "sh"
+	}
+	return "bash"
+}
+
+// argv returns the program and arguments running the check's cmd: through
+// its shell, or with shell "none" the cmd split into words and run
+// directly, so that nothing in it is interpreted by a shell.
+func (c Check) argv() ([]string, error) {
+	shell := c.Shell
+	if shell == "" {
+		shell = defaultShell()
+	}
+	switch shell {
+	case "none":
+		args, err := splitArgs(c.Cmd)
+		if err == nil && len(args) == 0 {
+			err = fmt.Errorf("cmd is empty")
+		}
+		return args, err
+	case "powershell":
+		return []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", c.Cmd}, nil
+	case "cmd":
+		return []string{"cmd", "/C", c.Cmd}, nil
+	}
+	return []string{shell, "-c", c.Cmd}, nil
+}
+
+// splitArgs splits s into words at unquoted whitespace. Single quotes keep
+// everything up to the next one, double quotes allow \" and \\ inside, and a
+// backslash outside quotes escapes the next character. Nothing is expanded.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ' in %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated \" in %q", s)
+			}
+			inWord = true
+		case ch == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Suffix of the detached minisign signature next to a signed file
+const signatureSuffix = ".minisig"
+
+// minisignKey is an Ed25519 public key in minisign format.
+type minisignKey struct {
+	id  [8]byte
+	key ed25519.PublicKey
+}
+
+// loadMinisignKey reads a minisign public key, given either as the key file
+// path or as the bare base64 key line.
+func loadMinisignKey(value string) (*minisignKey, error) {
+	text := value
+	if data, err := os.ReadFile(value); err == nil {
+		text = string(data)
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("public key: %w", err)
+		}
+		if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+			return nil, errors.New("public key: not a minisign Ed25519 key")
+		}
+		k := &minisignKey{key: ed25519.PublicKey(raw[10:])}
+		copy(k.id[:], raw[2:10])
+		return k, nil
+	}
+	return nil, errors.New("public key: no key found")
+}
+
+// verify checks a minisign signature file against data. Both the legacy
+// ("Ed") and the prehashed ("ED") signature algorithms are accepted, and the
+// global signature over the trusted comment must be valid as well.
+func (k *minisignKey) verify(data, sigFile []byte) error {
+	var lines []string
+	for _, line := range strings.Split(string(sigFile), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "untrusted comment:") || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed signature file")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+	if !bytes.Equal(sig[2:10], k.id[:]) {
+		return fmt.Errorf("signed with key %s, expected %s", keyID(sig[2:10]), keyID(k.id[:]))
+	}
+
+	message := data
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b.Sum512(data)
+		message = sum[:]
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(k.key, message, sig[10:]) {
+		return errors.New("invalid signature")
+	}
+
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return errors.New("malformed global signature")
+	}
+	signed := append(append([]byte{}, sig[10:]...), trusted...)
+	if !ed25519.Verify(k.key, signed, global) {
+		return errors.New("invalid trusted comment signature")
+	}
+	return nil
+}
+
+// verifyFile checks path against its detached signature at path+".minisig".
+func (k *minisignKey) verifyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(path + signatureSuffix)
+	if err != nil {
+		return fmt.Errorf("%s: signature: %w", path, err)
+	}
+	if err := k.verify(data, sig); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// keyID formats a key ID the way minisign displays it, as little-endian hex.
+func keyID(b []byte) string {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return strings.ToUpper(hex.EncodeToString(r))
+}
+
+// minisignSecretKey is an Ed25519 secret key in minisign format.
+type minisignSecretKey struct {
+	id  [8]byte
+	key ed25519.PrivateKey
+}
+
+// Environment variable holding the password of an encrypted secret key
+const signPasswordEnv = "KUMO_SIGN_PASSWORD"
+
+// loadMinisignSecretKey reads a secret key file created with minisign -G.
+// Encrypted keys are decrypted with password; keys created with -W need
+// none.
+func loadMinisignSecretKey(path, password string) (*minisignSecretKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []byte
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		if raw, err = base64.StdEncoding.DecodeString(line); err != nil {
+			return nil, fmt.Errorf("secret key: %w", err)
+		}
+		break
+	}
+	// sig_alg, kdf_alg, cksum_alg, kdf salt, opslimit, memlimit, then the
+	// key ID, secret key and checksum
+	const keynumLen = 8 + ed25519.PrivateKeySize + 32
+	if len(raw) != 2+2+2+32+8+8+keynumLen || string(raw[:2]) != "Ed" || string(raw[4:6]) != "B2" {
+		return nil, errors.New("secret key: not a minisign Ed25519 key")
+	}
+	keynum := append([]byte{}, raw[54:]...)
+
+	switch string(raw[2:4]) {
+	case "\x00\x00":
+	case "Sc":
+		if password == "" {
+			return nil, fmt.Errorf("secret key is encrypted; set %s", signPasswordEnv)
+		}
+		n, r, p := scryptParams(binary.LittleEndian.Uint64(raw[38:46]), binary.LittleEndian.Uint64(raw[46:54]))
+		stream, err := scrypt.Key([]byte(password), raw[6:38], n, r, p, keynumLen)
+		if err != nil {
+			return nil, fmt.Errorf("secret key: %w", err)
+		}
+		for i := range keynum {
+			keynum[i] ^= stream[i]
+		}
+	default:
+		return nil, fmt.Errorf("secret key: unsupported key derivation %q", raw[2:4])
+	}
+
+	k := &minisignSecretKey{key: ed25519.PrivateKey(keynum[8 : 8+ed25519.PrivateKeySize])}
+	copy(k.id[:], keynum[:8])
+	sum := blake2b.Sum256(append(append([]byte("Ed"), keynum[:8]...), k.key...))
+	if !bytes.Equal(sum[:], keynum[8+ed25519.PrivateKeySize:]) {
+		return nil, errors.New("secret key: wrong password or corrupted key")
+	}
+	return k, nil
+}
+
+// scryptParams converts libsodium's opslimit and memlimit, as stored in
+// minisign keys, to scrypt's N, r and p the way libsodium does.
+func scryptParams(opslimit, memlimit uint64) (n, r, p int) {
+	opslimit = max(opslimit, 32768)
+	r = 8
+	var maxN uint64
+	if opslimit < memlimit/32 {
+		p = 1
+		maxN = opslimit / (uint64(r) * 4)
+	} else {
+		maxN = memlimit / (uint64(r) * 128)
+	}
+	logN := uint(1)
+	for ; logN < 63; logN++ {
+		if uint64(1)<<logN > maxN/2 {
+			break
+		}
+	}
+	if opslimit >= memlimit/32 {
+		maxRP := min((opslimit/4)/(uint64(1)<<logN), 0x3fffffff)
+		p = int(maxRP / uint64(r))
+	}
+	return 1 << logN, r, p
+}
+
+// sign returns a prehashed ("ED") minisign signature file for data.
+func (k *minisignSecretKey) sign(data []byte, trustedComment string) []byte {
+	sum := blake2b.Sum512(data)
+	sig := ed25519.Sign(k.key, sum[:])
+	global := ed25519.Sign(k.key, append(append([]byte{}, sig...), trustedComment...))
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "untrusted comment: signature from kumo secret key %s\n", keyID(k.id[:]))
+	b.WriteString(base64.StdEncoding.EncodeToString(append(append([]byte("ED"), k.id[:]...), sig...)) + "\n")
+	fmt.Fprintf(&b, "trusted comment: %s\n", trustedComment)
+	b.WriteString(base64.StdEncoding.EncodeToString(global) + "\n")
+	return b.Bytes()
+}
+
+// signFile writes a detached signature for path to path+".minisig".
+func (k *minisignSecretKey) signFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("timestamp:%d\tfile:%s\thashed", time.Now().Unix(), filepath.Base(path))
+	return writeFileAtomic(path+signatureSuffix, k.sign(data, comment), 0o644)
+}
+
+// Loaded from --sign-key; reports written to files are signed with it
+var signingKey *minisignSecretKey
+
+// loadSigningKey loads the --sign-key secret key, if one was given.
+func loadSigningKey() error {
+	if signKeyPath == "" {
+		return nil
+	}
+	key, err := loadMinisignSecretKey(signKeyPath, os.Getenv(signPasswordEnv))
+	if err != nil {
+		return fmt.Errorf("Error loading signing key: %w", err)
+	}
+	signingKey = key
+	return nil
+}
+
+// signReport signs a report file written by kumo when --sign-key is set.
+func signReport(path string) error {
+	if signingKey == nil {
+		return nil
+	}
+	return signingKey.signFile(path)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Structured data ID of kumo's syslog messages. 32473 is the private
+// enterprise number reserved for examples (RFC 5612).
+const syslogSDID = "kumo@32473"
+
+// Facility of kumo's syslog messages (daemon)
+const syslogFacility = 3
+
+// Syslog severities
+const (
+	syslogErr     = 3
+	syslogWarning = 4
+	syslogNotice  = 5
+	syslogInfo    = 6
+)
+
+// syslogSeverity maps a result to a syslog severity: failures by the check's
+// severity, timeouts as warnings and everything else as info.
+func syslogSeverity(r CheckResult) int {
+	switch r.Status {
+	case statusFailed:
+		switch r.Severity {
+		case severityCritical:
+			return syslogErr
+		case severityInfo:
+			return syslogNotice
+		}
+		return syslogWarning
+	case statusTimedOut, statusCancelled:
+		return syslogWarning
+	}
+	return syslogInfo
+}
+
+// sendSyslog sends every result of the report to --syslog as an RFC 5424
+// message with the check's details as structured data.
+func sendSyslog(report *Report) {
+	if syslogTarget == "" {
+		return
+	}
+	conn, stream, err := dialSyslog(syslogTarget)
+	if err != nil {
+		log.Errorf("Error connecting to syslog: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	for _, r := range report.Results {
+		msg := formatSyslog(r, report.Hostname, time.Now())
+		if stream {
+			// Octet counting framing (RFC 6587)
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			log.Errorf("Error writing to syslog: %v", err)
+			return
+		}
+	}
+}
+
+// dialSyslog connects to "local" (the /dev/log socket) or a udp://, tcp://
+// host:port URL. stream reports whether messages need framing.
+func dialSyslog(target string) (conn net.Conn, stream bool, err error) {
+	if target == "local" {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err = net.Dial(network, "/dev/log"); err == nil {
+				return conn, network == "unix", nil
+			}
+		}
+		return nil, false, err
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, false, fmt.Errorf("invalid syslog target %q (use local, udp://host:port or tcp://host:port)", target)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "514")
+	}
+	switch u.Scheme {
+	case "udp":
+		conn, err = net.DialTimeout("udp", host, 10*time.Second)
+		return conn, false, err
+	case "tcp":
+		conn, err = net.DialTimeout("tcp", host, 10*time.Second)
+		return conn, true, err
+	}
+	return nil, false, fmt.Errorf("unsupported syslog scheme %q (use udp or tcp)", u.Scheme)
+}
+
+// formatSyslog formats a result as an RFC 5424 message. The timestamp has
+// microsecond precision, the most the RFC allows.
+func formatSyslog(r CheckResult, hostname string, now time.Time) string {
+	if hostname == "" {
+		hostname = "-"
+	}
+	pri := syslogFacility*8 + syslogSeverity(r)
+	sd := fmt.Sprintf(`[%s check="%s" status="%s" severity="%s" duration_seconds="%s"]`,
+		syslogSDID, escapeSDParam(r.Name), r.Status, r.Severity, formatNumber(r.Duration))
+	msg := strings.ReplaceAll(r.Message, "\n", " ")
+	return fmt.Sprintf("<%d>1 %s %s kumo %d - %s %s",
+		pri, now.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), hostname, os.Getpid(), sd, msg)
+}
+
+var sdParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func escapeSDParam(s string) string {
+	return sdParamEscaper.Replace(s)
+}
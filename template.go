@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+)
+
+// parseCommandTemplate parses a check command as a Go template. Referencing
+// a variable that isn't defined is an error rather than an empty string.
+func parseCommandTemplate(name, cmd string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(cmd)
+}
+
+// renderCommand expands {{ .var }} references in cmd from vars.
+func renderCommand(name, cmd string, vars map[string]any) (string, error) {
+	if !strings.Contains(cmd, "{{") {
+		return cmd, nil
+	}
+	tmpl, err := parseCommandTemplate(name, cmd)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
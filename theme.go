@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Theme maps the semantic TUI styles to colors: "#rrggbb" or "#rgb" hex, or
+// an ANSI color number from 0 to 255.
+type Theme struct {
+	Title   string `yaml:"title,omitempty" toml:"title"`
+	Success string `yaml:"success,omitempty" toml:"success"`
+	Error   string `yaml:"error,omitempty" toml:"error"`
+	Warning string `yaml:"warning,omitempty" toml:"warning"`
+	Info    string `yaml:"info,omitempty" toml:"info"`
+	Skipped string `yaml:"skipped,omitempty" toml:"skipped"`
+	Timeout string `yaml:"timeout,omitempty" toml:"timeout"`
+	Loading string `yaml:"loading,omitempty" toml:"loading"`
+	Footer  string `yaml:"footer,omitempty" toml:"footer"`
+}
+
+// Built-in themes for --theme. Custom themes start from dark.
+var themes = map[string]Theme{
+	"dark": {
+		Title:   "#FF79C6",
+		Success: "#50FA7B",
+		Error:   "#FF5555",
+		Warning: "#F1FA8C",
+		Info:    "#8BE9FD",
+		Skipped: "#6272A4",
+		Timeout: "#FFB86C",
+		Loading: "#F1FA8C",
+		Footer:  "#6272A4",
+	},
+	"light": {
+		Title:   "#A626A4",
+		Success: "#2E7D32",
+		Error:   "#C62828",
+		Warning: "#8D6E00",
+		Info:    "#0277BD",
+		Skipped: "#616161",
+		Timeout: "#D84315",
+		Loading: "#8D6E00",
+		Footer:  "#616161",
+	},
+}
+
+var themeColorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[0-9]|[1-9][0-9]|1[0-9][0-9]|2[0-4][0-9]|25[0-5])$`)
+
+// colors lists the fields of t by their config key.
+func (t *Theme) colors() []struct {
+	key   string
+	color *string
+} {
+	return []struct {
+		key   string
+		color *string
+	}{
+		{"title", &t.Title},
+		{"success", &t.Success},
+		{"error", &t.Error},
+		{"warning", &t.Warning},
+		{"info", &t.Info},
+		{"skipped", &t.Skipped},
+		{"timeout", &t.Timeout},
+		{"loading", &t.Loading},
+		{"footer", &t.Footer},
+	}
+}
+
+// validate checks that every color set in t is one lipgloss understands.
+func (t *Theme) validate() error {
+	for _, c := range t.colors() {
+		if *c.color != "" && !themeColorPattern.MatchString(*c.color) {
+			return fmt.Errorf("%s: invalid color %q (use #rrggbb, #rgb or 0-255)", c.key, *c.color)
+		}
+	}
+	return nil
+}
+
+// overlay returns t with the colors set in other replacing its own.
+func (t Theme) overlay(other Theme) Theme {
+	base := t.colors()
+	for i, c := range other.colors() {
+		if *c.color != "" {
+			*base[i].color = *c.color
+		}
+	}
+	return t
+}
+
+// Name of the theme applyTheme last set, for the help screen
+var activeTheme string
+
+// applyTheme sets the TUI styles from the --theme name. "custom" uses the
+// config's theme section on top of the dark theme; an empty name picks
+// custom when the config has a theme section and dark otherwise.
+func applyTheme(name string, custom *Theme) error {
+	if name == "" {
+		name = "dark"
+		if custom != nil {
+			name = "custom"
+		}
+	}
+
+	var t Theme
+	switch name {
+	case "custom":
+		if custom == nil {
+			return fmt.Errorf("--theme custom needs a theme section in the config")
+		}
+		t = themes["dark"].overlay(*custom)
+	default:
+		var ok bool
+		if t, ok = themes[name]; !ok {
+			return fmt.Errorf("Unknown theme %q (use dark, light or custom)", name)
+		}
+	}
+
+	activeTheme = name
+	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(t.Title))
+	successStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Success))
+	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Error))
+	warningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Warning))
+	infoStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Info))
+	skippedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Skipped))
+	timeoutStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Timeout))
+	loadingStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Loading)).Bold(true)
+	footerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Footer)).Italic(true)
+	return nil
+}
@@ -0,0 +1,1056 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+)
+
+type model struct {
+	checks  []Check
+	skipped []CheckResult
+	// One row per check followed by the skipped ones; checks that haven't
+	// finished yet are statusRunning
+	results []CheckResult
+	done    bool
+	// When the current run started and finished, for the status bar
+	startedAt, finishedAt time.Time
+	hostname              string
+	// Carries the results from the run to Update as checks finish
+	updates chan tea.Msg
+	// Context of the current run, cancelled when quitting while it runs,
+	// and its report once it finished
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	report *Report
+	// Rows are narrowed to names or statuses containing filter; editing is
+	// set while the "/" prompt is open
+	filter  string
+	editing bool
+	// Index into sortKeys, and whether to reverse it
+	sortKey  int
+	sortDesc bool
+	// Selected row in display order, and whether its detail view is open
+	cursor int
+	detail bool
+	// Whether "z" switched to the flat list, and the groups closed with
+	// Enter on their header
+	flat      bool
+	collapsed map[string]bool
+	// Checks toggled with "r" to show their raw output in the list
+	raw map[string]bool
+	// Why the last "R" could not reload the config
+	reloadErr error
+	// Whether the "?" help screen is open over the other views
+	help bool
+	// Shown in the footer until the next key press
+	notice string
+	// Scrolls the results, detail or help view once the terminal size is
+	// known
+	viewport      viewport.Model
+	listOffset    int // scroll position of the list while the detail view is open
+	helpOffset    int // scroll position of the view under the help screen
+	width, height int
+	quitting      bool
+	spinner       int
+}
+
+// Status of a TUI row whose check is still running
+const statusRunning = "Running"
+
+func newModel(checks []Check, skipped []CheckResult) model {
+	hostname, _ := os.Hostname()
+	return model{collapsed: make(map[string]bool), raw: make(map[string]bool), hostname: hostname}.load(checks, skipped)
+}
+
+// load replaces the check set and marks every check as running, keeping the
+// filter and sort order.
+func (m model) load(checks []Check, skipped []CheckResult) model {
+	results := make([]CheckResult, len(checks), len(checks)+len(skipped))
+	for i, check := range checks {
+		// Shown until the check starts
+		waiting := "Waiting for a free slot..."
+		if len(check.DependsOn) > 0 {
+			waiting = "Waiting for dependencies..."
+		}
+		results[i] = CheckResult{Name: check.Name, Status: statusRunning, Severity: check.severity(), Message: waiting}
+	}
+	m.checks = checks
+	m.skipped = skipped
+	m.results = append(results, skipped...)
+	m.done = false
+	m.startedAt = time.Now()
+	m.updates = make(chan tea.Msg, 2*len(checks)+1)
+	m.ctx, m.cancel = runContext()
+	m.report = nil
+	m.detail = false
+	return m
+}
+
+// Tick message type for spinner animation
+type tickMsg time.Time
+
+// Visual styles, set from the theme by applyTheme
+var (
+	titleStyle   lipgloss.Style
+	successStyle lipgloss.Style
+	errorStyle   lipgloss.Style
+	warningStyle lipgloss.Style
+	infoStyle    lipgloss.Style
+	skippedStyle lipgloss.Style
+	timeoutStyle lipgloss.Style
+	loadingStyle lipgloss.Style
+	footerStyle  lipgloss.Style
+)
+
+// Spinner animation frames
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// checkResultMsg delivers the result of the check at index as it finishes.
+type checkResultMsg struct {
+	index  int
+	result CheckResult
+}
+
+// checkStartedMsg tells that the check at index started executing.
+type checkStartedMsg struct {
+	index int
+	at    time.Time
+}
+
+// checksDoneMsg is sent once every check has finished, with the run's
+// report.
+type checksDoneMsg struct {
+	report *Report
+}
+
+type quitMsg struct{}
+
+// pagerDoneMsg reports that the pager started by pageSelected exited.
+type pagerDoneMsg struct{ err error }
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(m.start(), tick())
+}
+
+// start runs the checks in the background, sending their results to Update
+// as they finish.
+func (m model) start() tea.Cmd {
+	go func() {
+		report := runReportContext(m.ctx, m.cancel, m.checks, m.skipped, progress{
+			started: func(i int) {
+				m.updates <- checkStartedMsg{i, time.Now()}
+			},
+			finished: func(i int, result CheckResult) {
+				m.updates <- checkResultMsg{i, result}
+			},
+		})
+		m.updates <- checksDoneMsg{report}
+	}()
+	return m.waitForUpdate()
+}
+
+// rerun reloads the config and runs the checks again. If the config no
+// longer loads, the previous check set is run and the error shown.
+func (m model) rerun() (model, tea.Cmd) {
+	checks, skipped, err := prepareChecks()
+	m.reloadErr = err
+	if err != nil {
+		checks, skipped = m.checks, m.skipped
+	}
+	m = m.load(checks, skipped)
+	return m, m.start()
+}
+
+// completed counts the checks of the current run that have finished.
+func (m model) completed() int {
+	n := 0
+	for _, result := range m.results[:len(m.checks)] {
+		if result.Status != statusRunning {
+			n++
+		}
+	}
+	return n
+}
+
+// waitForUpdate returns the next message from the running checks.
+func (m model) waitForUpdate() tea.Cmd {
+	return func() tea.Msg {
+		return <-m.updates
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case checkStartedMsg:
+		m.results[msg.index].started = msg.at
+		return m, m.waitForUpdate()
+	case checkResultMsg:
+		m.results[msg.index] = msg.result
+		return m, m.waitForUpdate()
+	case checksDoneMsg:
+		m.done = true
+		m.finishedAt = time.Now()
+		m.report = msg.report
+		if m.quitting {
+			return m, tea.Quit
+		}
+		return m, nil
+	case tea.WindowSizeMsg:
+		// Rows rewrap to the new width, so keep the selection in view
+		m.width, m.height = msg.Width, msg.Height
+		if !m.help && !m.detail {
+			m.followCursor()
+		}
+		return m, nil
+	case tea.MouseMsg:
+		if m.editing {
+			return m, nil
+		}
+		return m.mouse(msg), nil
+	case tea.KeyMsg:
+		if m.editing {
+			return m.editFilter(msg), nil
+		}
+		m.notice = ""
+		m.viewport = m.sizedViewport()
+		if m.scroll(msg) {
+			return m, nil
+		}
+		switch {
+		case key.Matches(msg, keys.Quit):
+			return m, func() tea.Msg {
+				return quitMsg{}
+			}
+		case key.Matches(msg, keys.Copy) && !m.help:
+			m.notice = m.copySelected()
+			return m, nil
+		case key.Matches(msg, keys.Pager) && !m.help:
+			return m.pageSelected()
+		case key.Matches(msg, keys.Help):
+			m.help = !m.help
+			if m.help {
+				m.helpOffset = m.viewport.YOffset
+				m.viewport.GotoTop()
+			} else {
+				m.viewport = m.sizedViewport()
+				m.viewport.SetYOffset(m.helpOffset)
+			}
+			return m, nil
+		}
+		if m.help || m.detail {
+			switch {
+			case key.Matches(msg, keys.LineUp):
+				m.viewport.LineUp(1)
+			case key.Matches(msg, keys.LineDown):
+				m.viewport.LineDown(1)
+			case key.Matches(msg, keys.Back) && m.help:
+				m.help = false
+				m.viewport = m.sizedViewport()
+				m.viewport.SetYOffset(m.helpOffset)
+			case key.Matches(msg, keys.Back):
+				m.detail = false
+				m.viewport = m.sizedViewport()
+				m.viewport.SetYOffset(m.listOffset)
+			}
+			return m, nil
+		}
+		switch {
+		case key.Matches(msg, keys.Up):
+			m.cursor = max(m.cursor-1, 0)
+			m.followCursor()
+		case key.Matches(msg, keys.Down):
+			m.cursor = min(m.cursor+1, len(m.rows())-1)
+			m.followCursor()
+		case key.Matches(msg, keys.Details):
+			rows := m.rows()
+			switch {
+			case len(rows) == 0:
+			case rows[min(m.cursor, len(rows)-1)].group != nil:
+				name := rows[min(m.cursor, len(rows)-1)].group.name
+				m.collapsed[name] = !m.collapsed[name]
+			default:
+				m.detail = true
+				m.listOffset = m.viewport.YOffset
+				m.viewport.GotoTop()
+			}
+		case key.Matches(msg, keys.Raw):
+			if result, ok := m.selectedResult(); ok {
+				m.raw[result.Name] = !m.raw[result.Name]
+				m.followCursor()
+			}
+		case key.Matches(msg, keys.Flat):
+			m.flat = !m.flat
+			m.followCursor()
+		case key.Matches(msg, keys.Rerun):
+			if m.done {
+				return m.rerun()
+			}
+		case key.Matches(msg, keys.Filter):
+			m.editing = true
+		case key.Matches(msg, keys.Sort):
+			m.sortKey = (m.sortKey + 1) % len(sortKeys)
+		case key.Matches(msg, keys.Reverse):
+			m.sortDesc = !m.sortDesc
+		case key.Matches(msg, keys.ClearFilter):
+			m.filter = ""
+		}
+		return m, nil
+	case tickMsg:
+		m.spinner = (m.spinner + 1) % len(spinnerFrames)
+		return m, tick()
+	case pagerDoneMsg:
+		if msg.err != nil {
+			m.notice = fmt.Sprintf("Pager failed: %v", msg.err)
+		}
+		return m, nil
+	case quitMsg:
+		// A run in progress is cancelled like on SIGINT and kumo exits
+		// once its checks are reported as Cancelled; quitting again exits
+		// at once
+		if m.done || m.quitting {
+			m.quitting = true
+			return m, tea.Quit
+		}
+		m.quitting = true
+		m.cancel(quitError{})
+		return m, nil
+	}
+	return m, nil
+}
+
+// scroll handles the page-wise scrolling keys and reports whether msg was
+// one of them.
+func (m *model) scroll(msg tea.KeyMsg) bool {
+	switch {
+	case key.Matches(msg, keys.PageDown):
+		m.viewport.ViewDown()
+	case key.Matches(msg, keys.PageUp):
+		m.viewport.ViewUp()
+	case key.Matches(msg, keys.HalfDown):
+		m.viewport.HalfViewDown()
+	case key.Matches(msg, keys.HalfUp):
+		m.viewport.HalfViewUp()
+	case key.Matches(msg, keys.Top):
+		m.viewport.GotoTop()
+	case key.Matches(msg, keys.Bottom):
+		m.viewport.GotoBottom()
+	default:
+		return false
+	}
+	return true
+}
+
+// followCursor scrolls the list so the selected row stays visible.
+func (m *model) followCursor() {
+	m.viewport = m.sizedViewport()
+	_, body, _ := m.layout()
+	for i, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, selectedMarker) {
+			continue
+		}
+		switch {
+		case i < m.viewport.YOffset:
+			m.viewport.SetYOffset(i)
+		case i >= m.viewport.YOffset+m.viewport.Height:
+			m.viewport.SetYOffset(i - m.viewport.Height + 1)
+		}
+		return
+	}
+}
+
+// Lines the mouse wheel scrolls per step
+const wheelLines = 3
+
+// mouse scrolls with the wheel and selects the list row under a click.
+func (m model) mouse(msg tea.MouseMsg) model {
+	m.viewport = m.sizedViewport()
+	switch {
+	case msg.Button == tea.MouseButtonWheelUp:
+		m.viewport.LineUp(wheelLines)
+	case msg.Button == tea.MouseButtonWheelDown:
+		m.viewport.LineDown(wheelLines)
+	case msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress && !m.help && !m.detail:
+		if m.splitPane() && msg.X >= m.width/2 {
+			return m
+		}
+		header, _, _ := m.layout()
+		line := msg.Y - strings.Count(header, "\n")
+		if line < 0 || (m.scrolling() && line >= m.viewport.Height) {
+			return m
+		}
+		if m.scrolling() {
+			line += m.viewport.YOffset
+		}
+		if i, ok := m.rowAt(line); ok {
+			m.cursor = i
+		}
+	}
+	return m
+}
+
+// scrolling reports whether the body is taller than the screen, so View
+// shows it through the viewport.
+func (m model) scrolling() bool {
+	vp := m.sizedViewport()
+	return m.height > 0 && vp.TotalLineCount() > vp.Height
+}
+
+// rowAt maps a line of the list body to the row drawn on it.
+func (m model) rowAt(line int) (int, bool) {
+	_, rows := m.listBody()
+	if line < 0 || line >= len(rows) || rows[line] < 0 {
+		return 0, false
+	}
+	return rows[line], true
+}
+
+// editFilter applies a key press to the open filter prompt. Enter keeps the
+// filter, Esc clears it.
+func (m model) editFilter(msg tea.KeyMsg) model {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.editing = false
+	case tea.KeyEsc:
+		m.editing = false
+		m.filter = ""
+	case tea.KeyBackspace:
+		if r := []rune(m.filter); len(r) > 0 {
+			m.filter = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.filter += string(msg.Runes)
+	}
+	return m
+}
+
+// Orders the "s" key cycles through; the first keeps the check order
+var sortKeys = []struct {
+	name string
+	less func(a, b CheckResult) bool
+}{
+	{"config order", nil},
+	{"name", func(a, b CheckResult) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }},
+	{"status", func(a, b CheckResult) bool { return statusRank(a.Status) < statusRank(b.Status) }},
+	{"severity", func(a, b CheckResult) bool { return severityRanks[a.Severity] > severityRanks[b.Severity] }},
+	{"duration", func(a, b CheckResult) bool { return a.Duration > b.Duration }},
+}
+
+// statusRank orders failures first and rows still running last.
+func statusRank(status string) int {
+	switch status {
+	case statusFailed:
+		return 0
+	case statusTimedOut:
+		return 1
+	case statusPassed:
+		return 2
+	case statusCancelled:
+		return 3
+	case statusSkipped:
+		return 4
+	}
+	return 5
+}
+
+// visibleResults returns the rows matching the filter, case-insensitively by
+// name or status, in the selected order.
+func (m model) visibleResults() []CheckResult {
+	needle := strings.ToLower(m.filter)
+	var visible []CheckResult
+	for _, result := range m.results {
+		if strings.Contains(strings.ToLower(result.Name), needle) || strings.Contains(strings.ToLower(result.Status), needle) {
+			visible = append(visible, result)
+		}
+	}
+
+	if less := sortKeys[m.sortKey].less; less != nil {
+		sort.SliceStable(visible, func(i, j int) bool { return less(visible[i], visible[j]) })
+	}
+	if m.sortDesc {
+		slices.Reverse(visible)
+	}
+	return displayOrder(visible)
+}
+
+// displayOrder moves failed critical checks in front of the rest, the order
+// renderResults shows them in.
+func displayOrder(results []CheckResult) []CheckResult {
+	ordered := make([]CheckResult, 0, len(results))
+	for _, result := range results {
+		if isCriticalFailure(result) {
+			ordered = append(ordered, result)
+		}
+	}
+	for _, result := range results {
+		if !isCriticalFailure(result) {
+			ordered = append(ordered, result)
+		}
+	}
+	return ordered
+}
+
+func isCriticalFailure(result CheckResult) bool {
+	return result.Status == statusFailed && result.Severity == severityCritical
+}
+
+// selectedResult returns the check under the cursor; there is none when the
+// cursor is on a group header.
+func (m model) selectedResult() (CheckResult, bool) {
+	rows := m.rows()
+	if len(rows) == 0 {
+		return CheckResult{}, false
+	}
+	row := rows[min(m.cursor, len(rows)-1)]
+	return row.result, row.group == nil
+}
+
+func formatMessage(result CheckResult) string {
+	content := result.Message
+	if result.Status == statusSkipped {
+		return content
+	}
+	timing := fmt.Sprintf("(%.2fs)", result.Duration)
+	if result.CachedAt != nil {
+		timing = fmt.Sprintf("(%.2fs, cached %s ago)", result.Duration, time.Since(*result.CachedAt).Round(time.Second))
+	}
+
+	if strings.Contains(content, " (") {
+		return content + " " + timing
+	}
+
+	if strings.Contains(content, "\n") {
+		lines := strings.Split(content, "\n")
+		indentedLines := make([]string, len(lines))
+		indentedLines[0] = ""
+		for i := 1; i < len(lines); i++ {
+			indentedLines[i] = "        " + lines[i]
+		}
+		return strings.Join(indentedLines, "\n") + " " + timing
+	}
+
+	return content + " " + timing
+}
+
+// failureStyle picks the color of a failed check from its severity.
+func failureStyle(severity string) lipgloss.Style {
+	switch severity {
+	case severityCritical:
+		return errorStyle
+	case severityInfo:
+		return infoStyle
+	default:
+		return warningStyle
+	}
+}
+
+// Status symbols for terminals and their ASCII replacements for plain output
+var (
+	statusSymbols      = map[string]string{statusPassed: "✔", statusFailed: "✘", statusTimedOut: "!", statusCancelled: "⊘", statusSkipped: "–"}
+	plainStatusSymbols = map[string]string{statusPassed: "PASS", statusFailed: "FAIL", statusTimedOut: "TIME", statusCancelled: "CANC", statusSkipped: "SKIP"}
+)
+
+// Set when output must be plain ASCII without colors
+var plainOutput bool
+
+// resultCells returns the status symbol, name and message of a row and the
+// style of the message, colored by status. Running rows show the spinner
+// frame, and raw rows the command output as is below the timing instead of
+// the message.
+func resultCells(result CheckResult, spinner string, raw bool) (symbol, name, message string, style lipgloss.Style) {
+	if result.Status == statusRunning {
+		if result.started.IsZero() {
+			return skippedStyle.Render("·"), result.Name, result.Message, skippedStyle
+		}
+		elapsed := time.Since(result.started).Seconds()
+		return loadingStyle.Render(spinner), result.Name, fmt.Sprintf("Running... %.1fs", elapsed), loadingStyle
+	}
+	symbols := statusSymbols
+	if plainOutput {
+		symbols = plainStatusSymbols
+	}
+	messageStyle := successStyle
+	switch result.Status {
+	case statusFailed:
+		messageStyle = failureStyle(result.Severity)
+	case statusTimedOut:
+		messageStyle = timeoutStyle
+	case statusSkipped, statusCancelled:
+		messageStyle = skippedStyle
+	}
+	message = formatMessage(result)
+	if raw && result.Status != statusSkipped {
+		message = rawMessage(result)
+	}
+	return messageStyle.Render(symbols[result.Status]), result.Name, message, messageStyle
+}
+
+// rawMessage shows the timing followed by the untouched output lines, so
+// the columns of tools like free -m stay aligned.
+func rawMessage(result CheckResult) string {
+	message := fmt.Sprintf("(%.2fs)", result.Duration)
+	if result.output == "" {
+		return "(no output) " + message
+	}
+	for _, line := range strings.Split(result.output, "\n") {
+		message += "\n        " + line
+	}
+	return message
+}
+
+func (m model) View() string {
+	if m.quitting && !m.done {
+		return "Cancelling the running checks...\n"
+	}
+	if m.quitting {
+		return "Exiting...\n"
+	}
+
+	header, body, footer := m.layout()
+	vp := m.sizedViewport()
+	scrolling := m.height > 0 && vp.TotalLineCount() > vp.Height
+	view := strings.TrimSuffix(body, "\n")
+	if scrolling {
+		view = vp.View()
+	}
+	if m.splitPane() {
+		view = m.withDetailPane(view, vp.Height)
+	}
+	if !scrolling {
+		return header + view + "\n\n" + footer
+	}
+
+	// The blank line between the body and the footer shows the scroll
+	// position
+	position := footerStyle.Render(fmt.Sprintf("%3.f%% (PgUp/PgDn to scroll)", vp.ScrollPercent()*100))
+	return header + view + "\n" + position + "\n" + strings.TrimSuffix(footer, "\n")
+}
+
+// Terminal width from which the list gets a detail pane beside it
+const splitMinWidth = 140
+
+var detailPaneStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, false, false, true).PaddingLeft(1)
+
+// splitPane reports whether the list is shown next to a detail pane.
+func (m model) splitPane() bool {
+	return m.width >= splitMinWidth && !m.help && !m.detail
+}
+
+// withDetailPane cuts the list to the left half of the screen and shows the
+// selected check's details on the right, at most height lines of it.
+func (m model) withDetailPane(list string, height int) string {
+	left := m.width / 2
+	list = lipgloss.NewStyle().MaxWidth(left).Render(list)
+	list = lipgloss.NewStyle().Width(left).Render(list)
+
+	detail := ""
+	if result, ok := m.selectedResult(); ok {
+		detail = strings.TrimSuffix(m.renderDetail(result), "\n")
+	}
+	// Less the border and padding
+	right := m.width - left - 2
+	detail = lipgloss.NewStyle().MaxWidth(right).Render(detail)
+	if height > 0 {
+		detail = lipgloss.NewStyle().MaxHeight(height).Render(detail)
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, list, detailPaneStyle.Render(detail))
+}
+
+// layout renders the screen: a header above the scrolling body and a footer
+// below it.
+func (m model) layout() (header, body, footer string) {
+	header, body, footer = m.layoutView()
+	return header, body, footer + m.statusBar() + "\n"
+}
+
+// layoutView renders the current view without the status bar.
+func (m model) layoutView() (header, body, footer string) {
+	if m.help {
+		return "", m.renderHelp(), footerStyle.Render(shortHelp(keys.Back, keys.Quit)) + "\n"
+	}
+	if m.notice != "" {
+		footer = footerStyle.Render(m.notice) + "\n"
+	}
+	if m.detail {
+		if result, ok := m.selectedResult(); ok {
+			return "", m.renderDetail(result), footer + footerStyle.Render(shortHelp(keys.Back, keys.Copy, keys.Pager, keys.Quit, keys.Help)) + "\n"
+		}
+	}
+
+	if m.reloadErr != nil {
+		header += errorStyle.Render(fmt.Sprintf("Config reload failed, rerunning previous checks: %v", m.reloadErr)) + "\n\n"
+	}
+	if !m.done {
+		header += loadingStyle.Render(fmt.Sprintf("Performing system checks... %s %d/%d checks complete",
+			spinnerFrames[m.spinner], m.completed(), len(m.checks))) + "\n\n"
+	}
+
+	visible := m.visibleResults()
+	body, _ = m.listBody()
+
+	switch {
+	case m.editing:
+		footer += titleStyle.Render("/") + m.filter + "█\n"
+	case m.filter != "":
+		footer += footerStyle.Render(fmt.Sprintf("Filter %q: %d of %d checks (esc to clear)", m.filter, len(visible), len(m.results))) + "\n"
+	}
+	if m.sortKey != 0 || m.sortDesc {
+		footer += footerStyle.Render("Sorted by "+m.sortName()) + "\n"
+	}
+	footer += footerStyle.Render(shortHelp(keys.Quit, keys.Filter, keys.Sort, keys.Reverse, keys.Details, keys.Rerun, keys.Help)) + "\n"
+	return header, body, footer
+}
+
+// Reverse video keeps the status bar readable with any theme
+var statusBarStyle = lipgloss.NewStyle().Reverse(true)
+
+// statusBar summarizes the run on the bottom line: the host, how long it
+// has taken, the results so far and the profiles selected.
+func (m model) statusBar() string {
+	end := m.finishedAt
+	if !m.done {
+		end = time.Now()
+	}
+
+	var passed, failed, timedOut, cancelled, skipped, running int
+	for _, result := range m.results {
+		switch result.Status {
+		case statusPassed:
+			passed++
+		case statusFailed:
+			failed++
+		case statusTimedOut:
+			timedOut++
+		case statusCancelled:
+			cancelled++
+		case statusSkipped:
+			skipped++
+		case statusRunning:
+			running++
+		}
+	}
+	counts := []string{fmt.Sprintf("%d passed", passed)}
+	for _, c := range []struct {
+		n     int
+		label string
+	}{{failed, "failed"}, {timedOut, "timed out"}, {cancelled, "cancelled"}, {skipped, "skipped"}, {running, "running"}} {
+		if c.n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", c.n, c.label))
+		}
+	}
+
+	profile := "all checks"
+	if len(profiles) > 0 {
+		profile = "profile " + strings.Join(profiles, ",")
+	}
+
+	bar := " " + strings.Join([]string{
+		m.hostname,
+		fmt.Sprintf("%.1fs", end.Sub(m.startedAt).Seconds()),
+		strings.Join(counts, ", "),
+		profile,
+	}, " │ ") + " "
+	if pad := m.width - lipgloss.Width(bar); pad > 0 {
+		bar += strings.Repeat(" ", pad)
+	}
+	return statusBarStyle.Render(bar)
+}
+
+// listBody renders the results list, grouped or flat, and returns the row
+// drawn on each line.
+func (m model) listBody() (string, []int) {
+	width := m.width
+	if m.splitPane() {
+		width = m.width / 2
+	}
+	visible := m.visibleResults()
+	if m.grouped(m.groupResults(visible)) {
+		rows := m.rows()
+		return m.renderGroups(rows, spinnerFrames[m.spinner], min(m.cursor, len(rows)-1), width)
+	}
+	return renderResultLines(visible, spinnerFrames[m.spinner], min(m.cursor, len(visible)-1), m.raw, width)
+}
+
+// sortName describes the current sort order.
+func (m model) sortName() string {
+	order := sortKeys[m.sortKey].name
+	if m.sortDesc {
+		order += ", reversed"
+	}
+	return order
+}
+
+// sizedViewport returns the viewport fitted between the header and footer
+// and filled with the body.
+func (m model) sizedViewport() viewport.Model {
+	header, body, footer := m.layout()
+	// Width stays unset: the viewport would wrap long rows, while the
+	// renderer truncates them to the terminal
+	vp := m.viewport
+	// Header and footer lines end in newlines; one more line separates
+	// the body from the footer
+	vp.Height = max(m.height-strings.Count(header, "\n")-strings.Count(footer, "\n")-1, 1)
+	vp.SetContent(strings.TrimSuffix(body, "\n"))
+	return vp
+}
+
+// copySelected copies the selected check's command, output and remediation
+// to the clipboard with OSC 52, which works over SSH and in tmux, and
+// returns the notice to show.
+func (m model) copySelected() string {
+	result, ok := m.selectedResult()
+	if !ok {
+		return ""
+	}
+	if result.Status == statusRunning {
+		return result.Name + " is still running"
+	}
+	check := m.checkFor(result)
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s: %s\n", result.Name, result.Status)
+	if check.Cmd != "" {
+		fmt.Fprintf(&text, "$ %s\n", check.Cmd)
+	} else if check.Native != "" {
+		fmt.Fprintf(&text, "%s\n", check.command())
+	}
+	if result.output != "" {
+		text.WriteString(result.output + "\n")
+	} else if result.Message != "" {
+		text.WriteString(result.Message + "\n")
+	}
+	if check.Remediation != "" {
+		fmt.Fprintf(&text, "\nRemediation: %s\n", check.Remediation)
+	}
+	termenv.Copy(text.String())
+	return "Copied " + result.Name + " to the clipboard"
+}
+
+// pageSelected suspends the TUI and shows the selected check's raw output in
+// $PAGER, or less when it is unset.
+func (m model) pageSelected() (model, tea.Cmd) {
+	result, ok := m.selectedResult()
+	if !ok {
+		return m, nil
+	}
+	if result.output == "" {
+		m.notice = result.Name + " has no output"
+		return m, nil
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	// Through the shell, as PAGER may carry arguments like "less -R"
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(result.output)
+	return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return pagerDoneMsg{err}
+	})
+}
+
+// checkFor returns the check that produced result, or a zero Check for
+// skipped rows.
+func (m model) checkFor(result CheckResult) Check {
+	for _, c := range m.checks {
+		if c.Name == result.Name {
+			return c
+		}
+	}
+	return Check{}
+}
+
+// renderDetail shows everything known about one check.
+func (m model) renderDetail(result CheckResult) string {
+	check := m.checkFor(result)
+
+	var view strings.Builder
+	w := tabwriter.NewWriter(&view, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(w, titleStyle.Render(result.Name))
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Status:\t%s\n", result.Status)
+	fmt.Fprintf(w, "Severity:\t%s\n", result.Severity)
+	if len(check.Controls) > 0 {
+		fmt.Fprintf(w, "Controls:\t%s\n", strings.Join(check.Controls, ", "))
+	}
+	if result.Status != statusRunning && result.Status != statusSkipped {
+		fmt.Fprintf(w, "Duration:\t%.2fs\n", result.Duration)
+		if result.ExitCode != nil {
+			fmt.Fprintf(w, "Exit code:\t%d\n", *result.ExitCode)
+		}
+	}
+	w.Flush()
+
+	section := func(title, body string) {
+		if body == "" {
+			return
+		}
+		view.WriteString("\n" + titleStyle.Render(title) + "\n")
+		for _, line := range strings.Split(body, "\n") {
+			view.WriteString("    " + line + "\n")
+		}
+	}
+	section("Command", check.command())
+	section("Message", result.Message)
+	if result.stderr != "" {
+		section("Output", result.stdout)
+		section("Errors", result.stderr)
+	} else {
+		section("Output", result.output)
+	}
+	section("Remediation", check.Remediation)
+	return view.String()
+}
+
+// Prefix of the selected row
+const selectedMarker = "› "
+
+// renderResults lays out the results table, with failed critical checks in
+// their own section above the rest. spinner animates rows still running and
+// the row at index selected is marked; -1 marks none and leaves no room for
+// the marker.
+func renderResults(results []CheckResult, spinner string, selected int) string {
+	view, _ := renderResultLines(results, spinner, selected, nil, 0)
+	return view
+}
+
+// renderResultLines is renderResults that also returns the row drawn on
+// each line, or -1 for lines of no row, shows the checks named in raw with
+// their raw output and fits messages to width.
+func renderResultLines(results []CheckResult, spinner string, selected int, raw map[string]bool, width int) (string, []int) {
+	results = displayOrder(results)
+	table := newResultTable(results, spinner, raw, width)
+	marker := func(i int) string {
+		switch {
+		case selected < 0:
+			return ""
+		case i == selected:
+			return selectedMarker
+		}
+		return "  "
+	}
+
+	i := 0
+	if len(results) > 0 && isCriticalFailure(results[0]) {
+		table.line(errorStyle.Bold(true).Render("Critical Failures:"))
+		table.line("")
+		for ; i < len(results) && isCriticalFailure(results[i]); i++ {
+			table.row(i, marker(i), results[i], i == selected)
+		}
+		table.line("")
+	}
+
+	table.line(titleStyle.Render("System Check Results:"))
+	table.line("")
+
+	for ; i < len(results); i++ {
+		table.row(i, marker(i), results[i], i == selected)
+	}
+
+	return table.view.String(), table.rows
+}
+
+// Name of the selected row
+var selectedStyle = lipgloss.NewStyle().Reverse(true)
+
+// resultTable lays out result rows in aligned columns. Unlike tabwriter it
+// measures cells by their visible width, so colors don't shift the columns.
+// It also notes the row drawn on each line, -1 for other lines.
+type resultTable struct {
+	view                   strings.Builder
+	rows                   []int
+	spinner                string
+	symbolWidth, nameWidth int
+	// Names of the checks shown with their raw output
+	raw map[string]bool
+	// Screen width messages are fitted to; 0 leaves them as they are
+	width int
+}
+
+func newResultTable(results []CheckResult, spinner string, raw map[string]bool, width int) *resultTable {
+	t := &resultTable{spinner: spinner, raw: raw, width: width}
+	for _, result := range results {
+		symbol, name, _, _ := resultCells(result, spinner, false)
+		t.symbolWidth = max(t.symbolWidth, lipgloss.Width(symbol))
+		t.nameWidth = max(t.nameWidth, lipgloss.Width(name))
+	}
+	return t
+}
+
+// line adds a line that is not a row, such as a title.
+func (t *resultTable) line(s string) {
+	t.header(-1, s)
+}
+
+// header adds s as row i, which is not a check, such as a group header.
+func (t *resultTable) header(i int, s string) {
+	t.view.WriteString(s + "\n")
+	t.rows = append(t.rows, i)
+}
+
+// row adds result as row i, prefixed with marker. Multi-line messages take
+// a line each.
+func (t *resultTable) row(i int, marker string, result CheckResult, selected bool) {
+	symbol, name, message, style := resultCells(result, t.spinner, t.raw[result.Name])
+	pad := strings.Repeat(" ", t.nameWidth-lipgloss.Width(name))
+	if selected {
+		name = selectedStyle.Render(name)
+	}
+	prefix := marker + symbol + strings.Repeat(" ", t.symbolWidth-lipgloss.Width(symbol)) + "  " + name + pad + "    "
+	for j, line := range t.fit(message, lipgloss.Width(prefix)) {
+		if j == 0 {
+			line = prefix + style.Render(line)
+		} else {
+			line = style.Render(line)
+		}
+		t.view.WriteString(line + "\n")
+		t.rows = append(t.rows, i)
+	}
+}
+
+// Narrowest message column worth wrapping into
+const minMessageWidth = 20
+
+// fit splits message into lines for the screen width: the first line wraps
+// in the message column, indent cells from the left, and the lines below it
+// are output whose columns must stay intact, so they are cut at the edge.
+func (t *resultTable) fit(message string, indent int) []string {
+	lines := strings.Split(message, "\n")
+	if t.width == 0 {
+		return lines
+	}
+	var fitted []string
+	if limit := t.width - indent; limit >= minMessageWidth {
+		wrapped := strings.Split(ansi.Wrap(lines[0], limit, ""), "\n")
+		fitted = append(fitted, wrapped[0])
+		for _, line := range wrapped[1:] {
+			fitted = append(fitted, strings.Repeat(" ", indent)+strings.TrimLeft(line, " "))
+		}
+	} else {
+		fitted = append(fitted, lines[0])
+	}
+	for _, line := range lines[1:] {
+		fitted = append(fitted, ansi.Truncate(line, t.width, "…"))
+	}
+	return fitted
+}
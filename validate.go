@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runValidate implements "kumo validate": it parses and validates each given
+// config file or conf.d directory without running any checks and returns the
+// exit code.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: kumo validate CONFIG|DIR...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		var cfg *Config
+		var err error
+		if info, statErr := os.Stat(path); statErr == nil && info.IsDir() {
+			cfg, err = parseConfigDir(path)
+		} else {
+			cfg, err = parseConfig(path)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+
+		cfg, errs := assembleConfig(path, cfg)
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		if len(errs) > 0 {
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: OK (%d checks)\n", path, len(cfg.Checks))
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runVerify implements "kumo verify": it checks a report against its
+// detached minisign signature and returns the exit code.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	pubKey := fs.String("pubkey", "", "minisign public key (file or base64) the report was signed with")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: kumo verify --pubkey KEY REPORT [SIGNATURE]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *pubKey == "" || fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	key, err := loadMinisignKey(*pubKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	sigPath := path + signatureSuffix
+	if fs.NArg() == 2 {
+		sigPath = fs.Arg(1)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := key.verify(data, sig); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("%s: signature OK\n", path)
+	return 0
+}
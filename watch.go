@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Config changes are applied once the files have been quiet this long, so an
+// editor's write-rename sequence triggers a single reload.
+const reloadDebounce = 500 * time.Millisecond
+
+// runWatch runs the checks every interval until the process is stopped and
+// logs each result; a signal during a run ends the watch once the partial
+// run is logged. Changes to local config files reload the check set
+// without a restart; a config that fails to load keeps the previous set.
+func runWatch(interval time.Duration) error {
+	checks, skipped, err := prepareChecks()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := watchConfigFiles()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if metricsAddr != "" {
+		if err := serveMetrics(metricsAddr); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var reload <-chan time.Time
+	if logRun(checks, skipped).Interrupted {
+		return nil
+	}
+	for {
+		select {
+		case <-ticker.C:
+			if logRun(checks, skipped).Interrupted {
+				return nil
+			}
+		case event := <-watcher.Events:
+			if isConfigEvent(event) {
+				reload = time.After(reloadDebounce)
+			}
+		case err := <-watcher.Errors:
+			log.Warnf("Config watch error: %v", err)
+		case <-reload:
+			reload = nil
+			newChecks, newSkipped, err := prepareChecks()
+			if err != nil {
+				log.Errorf("Config reload failed, keeping previous checks: %v", err)
+				continue
+			}
+			logCheckDiff(checks, newChecks)
+			checks, skipped = newChecks, newSkipped
+		}
+	}
+}
+
+// logRun runs the checks once and logs every result.
+func logRun(checks []Check, skipped []CheckResult) *Report {
+	report := runReport(checks, skipped, headlessProgress(checks))
+	for _, result := range report.Results {
+		entry := log.WithFields(logrus.Fields{
+			"run_id":           report.RunID,
+			"check":            result.Name,
+			"status":           result.Status,
+			"severity":         result.Severity,
+			"duration_seconds": result.Duration,
+		})
+		switch result.Status {
+		case statusFailed, statusTimedOut, statusCancelled:
+			entry.Warn(result.Message)
+		default:
+			entry.Info(result.Message)
+		}
+	}
+	return report
+}
+
+// watchConfigFiles watches the directories holding the local config file,
+// config directory and env file. Directories rather than files are watched
+// because editors often replace a file instead of writing it in place.
+func watchConfigFiles() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, file := range configWatchFiles() {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	if configDir != "" {
+		dirs = append(dirs, configDir)
+	}
+	slices.Sort(dirs)
+	for _, dir := range slices.Compact(dirs) {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watch %s: %w", dir, err)
+		}
+	}
+	return watcher, nil
+}
+
+// configWatchFiles lists the individual files whose changes trigger a reload.
+// A remote config is only fetched at startup; by the time this runs
+// configPath points at its cached copy.
+func configWatchFiles() []string {
+	var files []string
+	if configPath != "" {
+		files = append(files, configPath)
+	}
+	if envFile != "" {
+		files = append(files, envFile)
+	}
+	return files
+}
+
+func isConfigEvent(event fsnotify.Event) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	for _, file := range configWatchFiles() {
+		if name == filepath.Clean(file) || name == filepath.Clean(file)+signatureSuffix {
+			return true
+		}
+	}
+	if configDir != "" && filepath.Dir(name) == filepath.Clean(configDir) {
+		switch strings.ToLower(filepath.Ext(strings.TrimSuffix(name, signatureSuffix))) {
+		case ".yaml", ".yml", ".toml":
+			return true
+		}
+	}
+	return false
+}
+
+// logCheckDiff logs which checks a reload added, removed or changed.
+func logCheckDiff(old, updated []Check) {
+	before := make(map[string]Check, len(old))
+	for _, check := range old {
+		before[check.Name] = check
+	}
+
+	var added, changed []string
+	for _, check := range updated {
+		prev, ok := before[check.Name]
+		switch {
+		case !ok:
+			added = append(added, check.Name)
+		case !reflect.DeepEqual(prev, check):
+			changed = append(changed, check.Name)
+		}
+		delete(before, check.Name)
+	}
+	var removed []string
+	for name := range before {
+		removed = append(removed, name)
+	}
+	slices.Sort(removed)
+
+	log.WithFields(logrus.Fields{
+		"added":   strings.Join(added, ", "),
+		"removed": strings.Join(removed, ", "),
+		"changed": strings.Join(changed, ", "),
+	}).Infof("Config reloaded: %d checks (+%d -%d ~%d)", len(updated), len(added), len(removed), len(changed))
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// systemFacts describes the host, for evaluating "when" conditions.
+type systemFacts struct {
+	OS        string   // distro ID from os-release, or GOOS without one
+	OSLike    []string // ID_LIKE from os-release
+	OSVersion string
+	Arch      string
+	Platform  string // GOOS
+
+	mu       sync.Mutex
+	commands map[string]bool
+}
+
+// detectFacts gathers the host facts used by "when" conditions.
+func detectFacts() *systemFacts {
+	f := &systemFacts{
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Platform: runtime.GOOS,
+		commands: make(map[string]bool),
+	}
+
+	release := readOSRelease("/etc/os-release")
+	if id := release["ID"]; id != "" {
+		f.OS = id
+	}
+	f.OSLike = strings.Fields(release["ID_LIKE"])
+	f.OSVersion = release["VERSION_ID"]
+	if f.OSVersion == "" {
+		f.OSVersion = kernelOSVersion()
+	}
+	return f
+}
+
+// readOSRelease parses an os-release file into its KEY=value pairs.
+func readOSRelease(path string) map[string]string {
+	values := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok && !strings.HasPrefix(key, "#") {
+			values[key] = strings.Trim(value, `"'`)
+		}
+	}
+	return values
+}
+
+func (f *systemFacts) hasCommand(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if found, ok := f.commands[name]; ok {
+		return found
+	}
+	_, err := exec.LookPath(name)
+	f.commands[name] = err == nil
+	return err == nil
+}
+
+func (f *systemFacts) hasFile(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Facts that can be compared in a condition
+var conditionFacts = []string{"os", "os_like", "os_version", "arch", "platform"}
+
+// variable returns the value of a scalar fact referenced in a condition.
+func (f *systemFacts) variable(name string) string {
+	switch name {
+	case "os":
+		return f.OS
+	case "os_version":
+		return f.OSVersion
+	case "arch":
+		return f.Arch
+	case "platform":
+		return f.Platform
+	}
+	return ""
+}
+
+// condition is a parsed "when" expression.
+type condition func(f *systemFacts) bool
+
+// parseCondition parses a "when" expression such as
+//
+//	os == "debian" && (has_command("ufw") || !has_file("/etc/nftables.conf"))
+//
+// Available facts are os, os_like, os_version, arch and platform, compared
+// with == or != against a quoted string. os_like == "x" holds when x is the
+// distro itself or listed in its ID_LIKE. has_command and has_file take one
+// quoted argument.
+func parseCondition(expr string) (condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{tokens: tokens}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return cond, nil
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenOp
+)
+
+type conditionToken struct {
+	kind tokenKind
+	text string
+}
+
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, conditionToken{tokenString, expr[i+1 : i+1+end]})
+			i += end + 2
+		case strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!=") ||
+			strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, conditionToken{tokenOp, expr[i : i+2]})
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			tokens = append(tokens, conditionToken{tokenOp, string(c)})
+			i++
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(expr) && (expr[i] == '_' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			tokens = append(tokens, conditionToken{tokenIdent, expr[start:i]})
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) peek(text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOp && p.tokens[p.pos].text == text
+}
+
+func (p *conditionParser) next(kind tokenKind, what string) (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("expected %s at end of expression", what)
+	}
+	tok := p.tokens[p.pos]
+	if tok.kind != kind {
+		return "", fmt.Errorf("expected %s, got %q", what, tok.text)
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+func (p *conditionParser) expect(op string) error {
+	if !p.peek(op) {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %q at end of expression", op)
+		}
+		return fmt.Errorf("expected %q, got %q", op, p.tokens[p.pos].text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *conditionParser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(f *systemFacts) bool { return l(f) || right(f) }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (condition, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("&&") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(f *systemFacts) bool { return l(f) && right(f) }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (condition, error) {
+	if p.peek("!") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(f *systemFacts) bool { return !inner(f) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (condition, error) {
+	if p.peek("(") {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+
+	name, err := p.next(tokenIdent, "a fact or function")
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "true":
+		return func(*systemFacts) bool { return true }, nil
+	case "false":
+		return func(*systemFacts) bool { return false }, nil
+	case "has_command", "has_file":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		arg, err := p.next(tokenString, "a quoted argument")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if name == "has_command" {
+			return func(f *systemFacts) bool { return f.hasCommand(arg) }, nil
+		}
+		return func(f *systemFacts) bool { return f.hasFile(arg) }, nil
+	}
+
+	var op string
+	switch {
+	case p.peek("=="), p.peek("!="):
+		op = p.tokens[p.pos].text
+		p.pos++
+	default:
+		return nil, fmt.Errorf("expected == or != after %s", name)
+	}
+	want, err := p.next(tokenString, "a quoted value")
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(conditionFacts, name) {
+		return nil, fmt.Errorf("unknown fact %q", name)
+	}
+	match := func(f *systemFacts) bool { return f.variable(name) == want }
+	if name == "os_like" {
+		match = func(f *systemFacts) bool { return f.OS == want || slices.Contains(f.OSLike, want) }
+	}
+	if op == "!=" {
+		return func(f *systemFacts) bool { return !match(f) }, nil
+	}
+	return match, nil
+}
+
+// selectWhen drops the checks whose "when" condition doesn't hold on this
+// host and returns them as Skipped results.
+func selectWhen(checks []Check, facts *systemFacts) ([]Check, []CheckResult) {
+	selected := make([]Check, 0, len(checks))
+	var skipped []CheckResult
+	for _, check := range checks {
+		if check.When == "" {
+			selected = append(selected, check)
+			continue
+		}
+		cond, err := parseCondition(check.When)
+		if err != nil {
+			skipped = append(skipped, skippedResult(check, fmt.Sprintf("invalid condition: %v", err)))
+			continue
+		}
+		if !cond(facts) {
+			skipped = append(skipped, skippedResult(check, "condition not met: "+check.When))
+			continue
+		}
+		selected = append(selected, check)
+	}
+	return selected, skipped
+}